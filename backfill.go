@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"log-pipeline/config"
+	"log-pipeline/internal/backfill"
+	"log-pipeline/internal/pipeline"
+	"log-pipeline/internal/processor"
+)
+
+// runBackfill implements the "backfill" subcommand.
+func runBackfill(args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	name := fs.String("pipeline", "", "Pipeline to backfill (defaults to the first one)")
+	from := fs.String("from", "", "Start of the range to backfill (RFC3339)")
+	to := fs.String("to", "", "End of the range to backfill (RFC3339, defaults to the resumed backfill's, or now)")
+	shard := fs.Duration("shard", time.Hour, "Length of the time range handled by one shard")
+	workers := fs.Int("workers", 4, "Number of shards processed concurrently")
+	stateFile := fs.String("state", "backfill-state.json", "File recording per-shard progress")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	pc := &cfg.Pipelines[0]
+	if *name != "" {
+		if pc, err = cfg.Pipeline(*name); err != nil {
+			log.Fatalf("Invalid -pipeline: %v", err)
+		}
+	}
+
+	if *from == "" {
+		log.Fatalf("backfill requires -from")
+	}
+	start, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	var end time.Time
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+
+	schemas, err := loadSchemas(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+
+	ctx, writeCtx, cancel := signalContexts(time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	// The running service owns the dedup journal
+	bc := *pc
+	if bc.Dedup.Type == "disk" {
+		bc.Dedup.Type = "memory"
+		bc.Dedup.Path = ""
+	}
+
+	// Workers share the pipeline's clients but each has its own batch
+	p, err := pipeline.New(writeCtx, bc, nil, schemas)
+	if err != nil {
+		log.Fatalf("Failed to create pipeline %s: %v", pc.Name, err)
+	}
+	defer p.Close()
+
+	b, err := backfill.New(backfill.Options{
+		Query:     pc.Loki.Query,
+		From:      start,
+		To:        end,
+		Shard:     *shard,
+		Workers:   *workers,
+		StateFile: *stateFile,
+	}, func() *processor.Processor {
+		return p.NewWorker(writeCtx)
+	})
+	if err != nil {
+		log.Fatalf("Failed to prepare backfill: %v", err)
+	}
+
+	if err := b.Run(ctx); err != nil {
+		log.Printf("Backfill failed: %v", err)
+		cancel()
+		p.Close()
+		os.Exit(1)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"time"
+
+	"log-pipeline/pkg/utils"
 )
 
 // Duration is a wrapper for time.Duration that implements json.Unmarshaler
@@ -31,18 +33,227 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 	}
 }
 
-type Config struct {
-	Loki struct {
-		URL      string   `json:"url"`
-		Query    string   `json:"query"`
-		Interval Duration `json:"interval"`
-	} `json:"loki"`
-	Victoria struct {
-		URL    string `json:"url"`
-		Schema string `json:"schema"`
-	} `json:"victoria"`
-	BatchSize  int      `json:"batchSize"`
+type LokiConfig struct {
+	URL      string   `json:"url"`
+	Query    string   `json:"query"`
+	Interval Duration `json:"interval"`
+	// Limit is the number of lines requested per query_range page
+	Limit int `json:"limit"`
+	// Mode is "poll" (default), "tail" or "push"
+	Mode string `json:"mode"`
+	// TailDelay is sent as delay_for (at most 5s)
+	TailDelay Duration `json:"tailDelay"`
+	// Auth authenticates requests to Loki and its health checks
+	Auth AuthConfig `json:"auth"`
+}
+
+// AuthConfig describes tenancy and authentication for an HTTP service.
+type AuthConfig struct {
+	// Tenant or Tenants are sent as X-Scope-OrgID
+	Tenant          string            `json:"tenant"`
+	Tenants         []string          `json:"tenants"`
+	Username        string            `json:"username"`
+	Password        string            `json:"password"`
+	BearerTokenFile string            `json:"bearerTokenFile"`
+	Headers         map[string]string `json:"headers"`
+	TLS             TLSConfig         `json:"tls"`
+}
+
+type TLSConfig struct {
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+func (a AuthConfig) empty() bool {
+	return a.Tenant == "" && a.Tenants == nil && a.Username == "" && a.BearerTokenFile == "" &&
+		a.Headers == nil && a.TLS == TLSConfig{}
+}
+
+type VictoriaConfig struct {
+	URL    string `json:"url"`
+	Schema string `json:"schema"`
+	// SchemaVersion is the version records are upgraded to (default latest)
+	SchemaVersion int      `json:"schemaVersion"`
+	MsgField      string   `json:"msgField"`
+	TimeField     string   `json:"timeField"`
+	StreamFields  []string `json:"streamFields"`
+	// Tenant selects the VictoriaLogs tenant records are written to
+	Tenant TenantConfig `json:"tenant"`
+}
+
+// TenantConfig describes the VictoriaLogs tenant of a pipeline, or how records
+// are routed to tenants by Field or Label.
+type TenantConfig struct {
+	AccountID uint32            `json:"accountID"`
+	ProjectID uint32            `json:"projectID"`
+	Field     string            `json:"field"`
+	Label     string            `json:"label"`
+	Tenants   map[string]string `json:"tenants"`
+	// MaxTenants caps the tenants parsed without Tenants (default 100)
+	MaxTenants int `json:"maxTenants"`
+}
+
+func (t TenantConfig) empty() bool {
+	return t.AccountID == 0 && t.ProjectID == 0 && t.Field == "" && t.Label == "" && t.Tenants == nil && t.MaxTenants == 0
+}
+
+type DedupConfig struct {
+	// Type is "memory" (TTL/LRU), "bloom" or "disk"
+	Type              string   `json:"type"`
+	MaxEntries        int      `json:"maxEntries"`
+	TTL               Duration `json:"ttl"`
+	Path              string   `json:"path"`
+	BloomBucket       Duration `json:"bloomBucket"`
+	BloomBuckets      int      `json:"bloomBuckets"`
+	FalsePositiveRate float64  `json:"falsePositiveRate"`
+	// Key selects the parts of a record that identify it
+	Key DedupKeyConfig `json:"key"`
+}
+
+type DedupKeyConfig struct {
+	Labels      []string `json:"labels"`
+	Fields      []string `json:"fields"`
+	Timestamp   bool     `json:"timestamp"`
+	ContentHash bool     `json:"contentHash"`
+}
+
+func (k DedupKeyConfig) empty() bool {
+	return k.Labels == nil && k.Fields == nil && !k.Timestamp && !k.ContentHash
+}
+
+// ParserConfig describes one parser stage.
+type ParserConfig struct {
+	// Type is "kv" (default), "logfmt", "json", "regex" or "passthrough"
+	Type      string `json:"type"`
+	Separator string `json:"separator"`
+	Delimiter string `json:"delimiter"`
+	Pattern   string `json:"pattern"`
+	Field     string `json:"field"`
+	// Source is the field to parse; the raw line is parsed if it is empty
+	Source     string `json:"source"`
+	KeepSource bool   `json:"keepSource"`
+}
+
+// TransformConfig describes one transform applied to every parsed record.
+type TransformConfig struct {
+	// Op is the transform, such as "rename" or "redact"
+	Op       string      `json:"op"`
+	Field    string      `json:"field"`
+	Fields   []string    `json:"fields"`
+	To       string      `json:"to"`
+	Label    string      `json:"label"`
+	Value    interface{} `json:"value"`
+	Template string      `json:"template"`
+	Type     string      `json:"type"`
+	Layout   string      `json:"layout"`
+	Timezone string      `json:"timezone"`
+	// Detectors, Patterns, Action, Mask, Key and KeyFile configure "redact"
+	Detectors []string `json:"detectors"`
+	Patterns  []string `json:"patterns"`
+	Action    string   `json:"action"`
+	Mask      string   `json:"mask"`
+	Key       string   `json:"key"`
+	KeyFile   string   `json:"keyFile"`
+}
+
+// auditTransforms maps the Telegraf and SQL Server keys onto the audit fields.
+func auditTransforms() []TransformConfig {
+	return []TransformConfig{
+		{Op: "drop", Fields: []string{"fields.Message", "fields.ProcessName", "fields.UserID", "fields.Version", "name"}},
+		{Op: "rename", Field: "fields.EventRecordID", To: "event_record_id"},
+		{Op: "rename", Field: "tags.Computer", To: "computer"},
+		{Op: "rename", Field: "Error", To: "error_code"},
+		{Op: "snake_case"},
+		{Op: "cast", Field: "event_record_id", Type: "int"},
+		{Op: "cast", Field: "timestamp", Type: "time", Layout: "unix"},
+		{Op: "cast", Field: "start_time", Type: "time", Layout: utils.SQLServerTimeLayout},
+		{Op: "cast", Field: "error_code", Type: "int"},
+		{Op: "cast", Field: "severity", Type: "int"},
+		{Op: "cast", Field: "state", Type: "int"},
+	}
+}
+
+// TimestampConfig selects the field holding the event time.
+type TimestampConfig struct {
+	// Field defaults to the Victoria time field
+	Field string `json:"field"`
+	// Layouts are Go layouts or epoch units, tried in order
+	Layouts []string `json:"layouts"`
+	// Timezone applies to times without a zone (default UTC)
+	Timezone string `json:"timezone"`
+}
+
+// PipelineConfig describes one Loki query shipped to one Victoria destination.
+type PipelineConfig struct {
+	Name          string         `json:"name"`
+	Loki          LokiConfig     `json:"loki"`
+	Victoria      VictoriaConfig `json:"victoria"`
+	BatchSize     int            `json:"batchSize"`
+	BatchMaxBytes int            `json:"batchMaxBytes"`
+	BatchLinger   Duration       `json:"batchLinger"`
+	// TimeWindow is how far back the first window reaches
 	TimeWindow Duration `json:"timeWindow"`
+	// IngestionDelay holds the end of every window back from now
+	IngestionDelay Duration `json:"ingestionDelay"`
+	// MaxWindow bounds the length of a window (default TimeWindow)
+	MaxWindow Duration    `json:"maxWindow"`
+	Dedup     DedupConfig `json:"dedup"`
+	// Parsers are applied in order; by default the Telegraf envelope and Parser
+	Parsers []ParserConfig `json:"parsers"`
+	Parser  ParserConfig   `json:"parser"`
+	// Transforms are applied in order; by default the audit field mapping
+	Transforms []TransformConfig `json:"transforms"`
+	// Timestamp is the event time shipped as the Victoria _time
+	Timestamp TimestampConfig `json:"timestamp"`
+	// RejectFile receives rejected records; they are only logged without it
+	RejectFile string `json:"rejectFile"`
+}
+
+// Config is the top-level configuration; the embedded PipelineConfig holds the
+// defaults of Pipelines.
+type Config struct {
+	PipelineConfig
+	Pipelines []PipelineConfig `json:"pipelines"`
+	// HealthCheckInterval is how often Loki and Victoria are probed for /readyz
+	HealthCheckInterval Duration `json:"healthCheckInterval"`
+	// LivenessTimeout is how long /livez allows between windows
+	LivenessTimeout Duration `json:"livenessTimeout"`
+	// ShutdownTimeout bounds how long buffered records are drained on exit
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// CheckpointFile stores the per-pipeline watermark between restarts
+	CheckpointFile string `json:"checkpointFile"`
+	// SchemaFiles are loaded into the schema registry
+	SchemaFiles []string `json:"schemaFiles"`
+	// Push configures the receiver of push-mode pipelines
+	Push PushConfig `json:"push"`
+}
+
+// PushConfig configures the Loki-compatible push receiver.
+type PushConfig struct {
+	// Addr serves /loki/api/v1/push (default ":3100")
+	Addr string `json:"addr"`
+	// MaxBodyBytes bounds the size of a push request (default 16MB)
+	MaxBodyBytes int64 `json:"maxBodyBytes"`
+	// Auth restricts who may push; without it any request is accepted
+	Auth PushAuthConfig `json:"auth"`
+}
+
+// PushAuthConfig describes the credentials and tenants a push must carry.
+type PushAuthConfig struct {
+	// Tenants are the accepted X-Scope-OrgID values
+	Tenants  []string `json:"tenants"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	// BearerTokenFile holds the expected "Authorization: Bearer" token
+	BearerTokenFile string `json:"bearerTokenFile"`
+}
+
+// Open reports whether the receiver accepts unauthenticated pushes.
+func (c PushConfig) Open() bool {
+	return len(c.Auth.Tenants) == 0 && c.Auth.Username == "" && c.Auth.BearerTokenFile == ""
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -64,19 +275,284 @@ func LoadConfig(path string) (*Config, error) {
 		config.Victoria.URL = url
 	}
 
-	// Validate required fields
-	if config.Loki.URL == "" {
-		return nil, fmt.Errorf("loki URL is required")
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = Duration(15 * time.Second)
+	}
+	if config.LivenessTimeout <= 0 {
+		config.LivenessTimeout = Duration(10 * time.Minute)
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = Duration(8 * time.Second)
+	}
+	if config.CheckpointFile == "" {
+		config.CheckpointFile = "checkpoints.json"
 	}
-	if config.Victoria.URL == "" {
-		return nil, fmt.Errorf("victoria URL is required")
+	if config.Push.Addr == "" {
+		config.Push.Addr = ":3100"
 	}
-	if config.Loki.Query == "" {
-		return nil, fmt.Errorf("loki query is required")
+	if config.Push.MaxBodyBytes <= 0 {
+		config.Push.MaxBodyBytes = 16 << 20
 	}
-	if config.Victoria.Schema == "" {
-		return nil, fmt.Errorf("victoria schema is required")
+	if config.Push.Auth.Password != "" && config.Push.Auth.Username == "" {
+		return nil, fmt.Errorf("push.auth.password requires push.auth.username")
+	}
+
+	legacy := len(config.Pipelines) == 0
+	if legacy {
+		legacy := config.PipelineConfig
+		if legacy.Name == "" {
+			legacy.Name = "default"
+		}
+		config.Pipelines = []PipelineConfig{legacy}
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Pipelines {
+		p := &config.Pipelines[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("pipeline %d has no name", i)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("pipeline name %q is used more than once", p.Name)
+		}
+		names[p.Name] = true
+
+		if !legacy {
+			p.inherit(&config.PipelineConfig)
+		}
+		p.setDefaults()
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("pipeline %q: %v", p.Name, err)
+		}
 	}
 
 	return &config, nil
-}
\ No newline at end of file
+}
+
+// Pipeline returns the pipeline called name.
+func (c *Config) Pipeline(name string) (*PipelineConfig, error) {
+	for i := range c.Pipelines {
+		if c.Pipelines[i].Name == name {
+			return &c.Pipelines[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no pipeline named %q", name)
+}
+
+// inherit copies the settings left unset from the top-level defaults.
+func (p *PipelineConfig) inherit(d *PipelineConfig) {
+	if p.Loki.URL == "" {
+		p.Loki.URL = d.Loki.URL
+	}
+	if p.Loki.Interval == 0 {
+		p.Loki.Interval = d.Loki.Interval
+	}
+	if p.Loki.Limit == 0 {
+		p.Loki.Limit = d.Loki.Limit
+	}
+	if p.Loki.Auth.empty() {
+		p.Loki.Auth = d.Loki.Auth
+	}
+	if p.Loki.Mode == "" {
+		p.Loki.Mode = d.Loki.Mode
+	}
+	if p.Loki.TailDelay == 0 {
+		p.Loki.TailDelay = d.Loki.TailDelay
+	}
+
+	if p.Victoria.URL == "" {
+		p.Victoria.URL = d.Victoria.URL
+	}
+	if p.Victoria.Schema == "" {
+		p.Victoria.Schema = d.Victoria.Schema
+	}
+	if p.Victoria.SchemaVersion == 0 {
+		p.Victoria.SchemaVersion = d.Victoria.SchemaVersion
+	}
+	if p.Victoria.MsgField == "" {
+		p.Victoria.MsgField = d.Victoria.MsgField
+	}
+	if p.Victoria.TimeField == "" {
+		p.Victoria.TimeField = d.Victoria.TimeField
+	}
+	if p.Victoria.StreamFields == nil {
+		p.Victoria.StreamFields = d.Victoria.StreamFields
+	}
+	if p.Victoria.Tenant.empty() {
+		p.Victoria.Tenant = d.Victoria.Tenant
+	}
+
+	if p.BatchSize == 0 {
+		p.BatchSize = d.BatchSize
+	}
+	if p.BatchMaxBytes == 0 {
+		p.BatchMaxBytes = d.BatchMaxBytes
+	}
+	if p.BatchLinger == 0 {
+		p.BatchLinger = d.BatchLinger
+	}
+	if p.TimeWindow == 0 {
+		p.TimeWindow = d.TimeWindow
+	}
+	if p.IngestionDelay == 0 {
+		p.IngestionDelay = d.IngestionDelay
+	}
+	if p.MaxWindow == 0 {
+		p.MaxWindow = d.MaxWindow
+	}
+
+	if p.Dedup.Type == "" {
+		p.Dedup.Type = d.Dedup.Type
+	}
+	if p.Dedup.MaxEntries == 0 {
+		p.Dedup.MaxEntries = d.Dedup.MaxEntries
+	}
+	if p.Dedup.TTL == 0 {
+		p.Dedup.TTL = d.Dedup.TTL
+	}
+	if p.Dedup.Path == "" && d.Dedup.Path != "" {
+		// Every pipeline keeps its own journal
+		p.Dedup.Path = d.Dedup.Path + "." + p.Name
+	}
+	if p.Dedup.BloomBucket == 0 {
+		p.Dedup.BloomBucket = d.Dedup.BloomBucket
+	}
+	if p.Dedup.BloomBuckets == 0 {
+		p.Dedup.BloomBuckets = d.Dedup.BloomBuckets
+	}
+	if p.Dedup.FalsePositiveRate == 0 {
+		p.Dedup.FalsePositiveRate = d.Dedup.FalsePositiveRate
+	}
+	if p.Dedup.Key.empty() {
+		p.Dedup.Key = d.Dedup.Key
+	}
+
+	if p.Parsers == nil {
+		p.Parsers = d.Parsers
+	}
+	if p.Parser.Type == "" {
+		p.Parser.Type = d.Parser.Type
+	}
+	if p.Parser.Separator == "" {
+		p.Parser.Separator = d.Parser.Separator
+	}
+	if p.Parser.Delimiter == "" {
+		p.Parser.Delimiter = d.Parser.Delimiter
+	}
+	if p.Parser.Pattern == "" {
+		p.Parser.Pattern = d.Parser.Pattern
+	}
+	if p.Parser.Field == "" {
+		p.Parser.Field = d.Parser.Field
+	}
+	if p.Parser.Source == "" {
+		p.Parser.Source = d.Parser.Source
+	}
+	if !p.Parser.KeepSource {
+		p.Parser.KeepSource = d.Parser.KeepSource
+	}
+	if p.Transforms == nil {
+		p.Transforms = d.Transforms
+	}
+	if p.Timestamp.Field == "" {
+		p.Timestamp.Field = d.Timestamp.Field
+	}
+	if p.Timestamp.Layouts == nil {
+		p.Timestamp.Layouts = d.Timestamp.Layouts
+	}
+	if p.Timestamp.Timezone == "" {
+		p.Timestamp.Timezone = d.Timestamp.Timezone
+	}
+	if p.RejectFile == "" && d.RejectFile != "" {
+		// Every pipeline keeps its own reject file
+		p.RejectFile = d.RejectFile + "." + p.Name
+	}
+}
+
+func (p *PipelineConfig) setDefaults() {
+	if p.Loki.Interval <= 0 {
+		p.Loki.Interval = Duration(time.Minute)
+	}
+	if p.Loki.Mode == "" {
+		p.Loki.Mode = "poll"
+	}
+	if p.TimeWindow <= 0 {
+		p.TimeWindow = Duration(5 * time.Minute)
+	}
+	if p.MaxWindow <= 0 {
+		p.MaxWindow = p.TimeWindow
+	}
+
+	// Default the VictoriaLogs field mapping to the audit log layout
+	if p.Victoria.MsgField == "" {
+		p.Victoria.MsgField = "text_data"
+	}
+	if p.Victoria.TimeField == "" {
+		p.Victoria.TimeField = "timestamp"
+	}
+	if p.Victoria.StreamFields == nil {
+		p.Victoria.StreamFields = []string{"computer", "trace_type"}
+	}
+	if p.Victoria.Tenant.MaxTenants <= 0 {
+		p.Victoria.Tenant.MaxTenants = 100
+	}
+
+	// EventRecordID is only unique per event log and computer
+	if p.Dedup.Key.empty() {
+		p.Dedup.Key.Fields = []string{"computer", "event_record_id"}
+	}
+
+	if len(p.Parsers) == 0 {
+		data := p.Parser
+		if data.Source == "" {
+			data.Source = "fields.Data"
+		}
+		p.Parsers = []ParserConfig{{Type: "json"}, data}
+	}
+	if p.Transforms == nil {
+		p.Transforms = auditTransforms()
+	}
+	if p.Timestamp.Field == "" {
+		p.Timestamp.Field = p.Victoria.TimeField
+	}
+	if p.Timestamp.Layouts == nil {
+		p.Timestamp.Layouts = []string{time.RFC3339Nano}
+	}
+
+	// Default the batching limits
+	if p.BatchSize <= 0 {
+		p.BatchSize = 1000
+	}
+	if p.BatchMaxBytes <= 0 {
+		p.BatchMaxBytes = 4 << 20
+	}
+	if p.BatchLinger <= 0 {
+		p.BatchLinger = Duration(5 * time.Second)
+	}
+}
+
+// validate checks the required fields
+func (p *PipelineConfig) validate() error {
+	if p.Loki.URL == "" && p.Loki.Mode != "push" {
+		return fmt.Errorf("loki URL is required")
+	}
+	if p.Victoria.URL == "" {
+		return fmt.Errorf("victoria URL is required")
+	}
+	if p.Loki.Query == "" {
+		return fmt.Errorf("loki query is required")
+	}
+	if p.Loki.Mode != "poll" && p.Loki.Mode != "tail" && p.Loki.Mode != "push" {
+		return fmt.Errorf("unknown loki mode %q", p.Loki.Mode)
+	}
+	if p.IngestionDelay < 0 {
+		return fmt.Errorf("ingestionDelay must not be negative")
+	}
+	if p.Loki.TailDelay < 0 || p.Loki.TailDelay > Duration(5*time.Second) {
+		return fmt.Errorf("loki tailDelay must be between 0 and 5s")
+	}
+	if p.Victoria.Schema == "" {
+		return fmt.Errorf("victoria schema is required")
+	}
+	return nil
+}
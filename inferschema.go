@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"log-pipeline/config"
+	"log-pipeline/internal/loki"
+	"log-pipeline/internal/pipeline"
+	"log-pipeline/internal/processor"
+	"log-pipeline/internal/schema"
+)
+
+// runInferSchema implements the "infer-schema" subcommand.
+func runInferSchema(args []string) {
+	fs := flag.NewFlagSet("infer-schema", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	name := fs.String("pipeline", "", "Pipeline to sample (defaults to the first one)")
+	from := fs.String("from", "", "Start of the range to sample (RFC3339, defaults to -window before -to)")
+	to := fs.String("to", "", "End of the range to sample (RFC3339, defaults to now)")
+	window := fs.Duration("window", time.Hour, "Length of the range to sample when -from is unset")
+	limit := fs.Int("limit", 10000, "Most records to sample, from the start of the range (0 for all)")
+	schemaName := fs.String("schema", "", "Name of the inferred schema (defaults to the pipeline name)")
+	out := fs.String("out", "", "File the schema is written to (defaults to stdout)")
+	maxCardinality := fs.Int("stream-cardinality", 100, "Most distinct values a suggested stream field may have")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	pc := &cfg.Pipelines[0]
+	if *name != "" {
+		if pc, err = cfg.Pipeline(*name); err != nil {
+			log.Fatalf("Invalid -pipeline: %v", err)
+		}
+	}
+	if *schemaName == "" {
+		*schemaName = pc.Name
+	}
+
+	end := time.Now()
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+	start := end.Add(-*window)
+	if *from != "" {
+		if start, err = time.Parse(time.RFC3339, *from); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+	}
+
+	parsers, transforms, err := pipeline.NewStages(*pc)
+	if err != nil {
+		log.Fatalf("Failed to create pipeline %s: %v", pc.Name, err)
+	}
+
+	ctx, _, cancel := signalContexts(time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	client, err := loki.NewClient(pc.Name, pc.Loki.URL, pc.Loki.Limit, pipeline.LokiAuth(pc.Loki))
+	if err != nil {
+		log.Fatalf("Failed to create Loki client: %v", err)
+	}
+	logs, err := client.SampleLogs(ctx, pc.Loki.Query, start, end, *limit)
+	if err != nil {
+		log.Fatalf("Failed to query Loki: %v", err)
+	}
+
+	inferrer := schema.NewInferrer()
+	failed := 0
+	for _, result := range logs.Data.Result {
+		for _, value := range result.Values {
+			rec, err := processor.Prepare(value, result.Stream, parsers, transforms)
+			if err != nil {
+				failed++
+				continue
+			}
+			inferrer.Observe(rec)
+		}
+	}
+	if inferrer.Records() == 0 {
+		log.Fatalf("No records to sample between %v and %v (%d failed to parse)", start, end, failed)
+	}
+
+	log.Printf("Sampled %d records, %d failed to parse", inferrer.Records(), failed)
+	for _, f := range inferrer.Stats() {
+		log.Printf("  %-30s %-9s present %5.1f%%  distinct %d", f.Name, f.Type,
+			100*float64(f.Present)/float64(inferrer.Records()), f.Distinct)
+	}
+	log.Printf("Suggested streamFields: %q", inferrer.StreamFields(*maxCardinality))
+
+	data, err := json.MarshalIndent(inferrer.Schema(*schemaName), "", "    ")
+	if err != nil {
+		log.Fatalf("Failed to encode schema: %v", err)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		fmt.Print(string(data))
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("Failed to write schema: %v", err)
+	}
+	log.Printf("Schema written to %s", *out)
+}
@@ -0,0 +1,246 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"log-pipeline/internal/processor"
+)
+
+// Options describes a historical backfill.
+type Options struct {
+	// Query identifies the backfill in the state file
+	Query string
+	From  time.Time
+	// To defaults to the recorded end when resuming, and to now otherwise
+	To time.Time
+	// Shard is the length of the time range handled by one unit of work
+	Shard time.Duration
+	// Workers is the number of shards processed concurrently
+	Workers int
+	// StateFile records per-shard progress so an interrupted backfill resumes
+	StateFile string
+	// Progress is how often throughput and ETA are reported
+	Progress time.Duration
+}
+
+type shard struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Done  bool      `json:"done"`
+	Lines int64     `json:"lines"`
+}
+
+type state struct {
+	Query  string    `json:"query"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Shards []shard   `json:"shards"`
+}
+
+// Backfill ships a historical time range in shards with a pool of workers.
+type Backfill struct {
+	opts         Options
+	newProcessor func() *processor.Processor
+
+	mutex  sync.Mutex
+	state  state
+	lines  int64
+	failed int
+}
+
+// New prepares a backfill. newProcessor is called once per worker.
+func New(opts Options, newProcessor func() *processor.Processor) (*Backfill, error) {
+	if opts.Shard <= 0 {
+		opts.Shard = time.Hour
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Progress <= 0 {
+		opts.Progress = 10 * time.Second
+	}
+
+	b := &Backfill{
+		opts:         opts,
+		newProcessor: newProcessor,
+	}
+	if err := b.loadState(); err != nil {
+		return nil, err
+	}
+	if !b.opts.From.Before(b.opts.To) {
+		return nil, fmt.Errorf("backfill start %v must be before end %v", b.opts.From, b.opts.To)
+	}
+	return b, nil
+}
+
+// Run processes every pending shard; failed shards are retried on the next run.
+func (b *Backfill) Run(ctx context.Context) error {
+	pending := make(chan int)
+	var wg sync.WaitGroup
+
+	total, remaining := b.counts()
+	log.Printf("Backfilling %s from %v to %v: %d shards, %d pending, %d workers",
+		b.opts.Query, b.opts.From, b.opts.To, total, remaining, b.opts.Workers)
+
+	for i := 0; i < b.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.work(ctx, b.newProcessor(), pending)
+		}()
+	}
+
+	stop := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		b.reportProgress(stop, remaining)
+	}()
+
+dispatch:
+	for i := range b.state.Shards {
+		if b.state.Shards[i].Done {
+			continue
+		}
+		select {
+		case pending <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(pending)
+	wg.Wait()
+	close(stop)
+	<-progressDone
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("backfill interrupted; rerun it to resume from %s", b.opts.StateFile)
+	}
+	if b.failed > 0 {
+		return fmt.Errorf("%d shards failed; rerun the backfill to retry them", b.failed)
+	}
+	log.Printf("Backfill complete: %d lines shipped", b.lines)
+	return nil
+}
+
+func (b *Backfill) work(ctx context.Context, proc *processor.Processor, pending <-chan int) {
+	for i := range pending {
+		s := b.state.Shards[i]
+
+		before, _, _ := proc.GetStats()
+		err := proc.ProcessLogs(ctx, s.Start, s.End)
+		after, _, _ := proc.GetStats()
+		lines := after - before
+
+		b.mutex.Lock()
+		b.lines += lines
+		if err != nil {
+			b.failed++
+			log.Printf("Shard %v - %v failed: %v", s.Start, s.End, err)
+		} else {
+			b.state.Shards[i].Done = true
+			b.state.Shards[i].Lines = lines
+			if err := b.saveLocked(); err != nil {
+				log.Printf("Failed to save backfill state: %v", err)
+			}
+		}
+		b.mutex.Unlock()
+	}
+}
+
+// reportProgress logs throughput and an ETA until stop is closed.
+func (b *Backfill) reportProgress(stop <-chan struct{}, pendingAtStart int) {
+	started := time.Now()
+	ticker := time.NewTicker(b.opts.Progress)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			total, remaining := b.counts()
+			b.mutex.Lock()
+			lines := b.lines
+			b.mutex.Unlock()
+
+			elapsed := time.Since(started)
+			rate := float64(lines) / elapsed.Seconds()
+			eta := "unknown"
+			if done := pendingAtStart - remaining; done > 0 {
+				eta = (elapsed / time.Duration(done) * time.Duration(remaining)).Round(time.Second).String()
+			}
+			log.Printf("Backfill progress: %d/%d shards, %d lines, %.1f lines/s, ETA %s",
+				total-remaining, total, lines, rate, eta)
+		}
+	}
+}
+
+func (b *Backfill) counts() (total, remaining int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, s := range b.state.Shards {
+		if !s.Done {
+			remaining++
+		}
+	}
+	return len(b.state.Shards), remaining
+}
+
+// loadState resumes from the state file or splits the range into shards.
+func (b *Backfill) loadState() error {
+	if b.opts.StateFile != "" {
+		data, err := os.ReadFile(b.opts.StateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read backfill state: %v", err)
+		}
+		if err == nil {
+			var st state
+			if err := json.Unmarshal(data, &st); err != nil {
+				return fmt.Errorf("failed to parse backfill state %s: %v", b.opts.StateFile, err)
+			}
+			if st.Query == b.opts.Query && st.From.Equal(b.opts.From) && (b.opts.To.IsZero() || st.To.Equal(b.opts.To)) {
+				b.opts.To = st.To
+				b.state = st
+				return nil
+			}
+			log.Printf("Ignoring backfill state %s: it describes a different query or range", b.opts.StateFile)
+		}
+	}
+	if b.opts.To.IsZero() {
+		b.opts.To = time.Now()
+	}
+
+	b.state = state{Query: b.opts.Query, From: b.opts.From, To: b.opts.To}
+	for start := b.opts.From; start.Before(b.opts.To); start = start.Add(b.opts.Shard) {
+		end := start.Add(b.opts.Shard)
+		if end.After(b.opts.To) {
+			end = b.opts.To
+		}
+		b.state.Shards = append(b.state.Shards, shard{Start: start, End: end})
+	}
+	return nil
+}
+
+func (b *Backfill) saveLocked() error {
+	if b.opts.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(b.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := b.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.opts.StateFile)
+}
@@ -0,0 +1,64 @@
+package backfill
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResume(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorded := from.Add(3 * time.Hour)
+
+	tests := []struct {
+		name       string
+		query      string
+		to         time.Time
+		wantTo     time.Time
+		wantResume bool
+	}{
+		{name: "same range", query: "{job=\"a\"}", to: recorded, wantTo: recorded, wantResume: true},
+		{name: "end omitted", query: "{job=\"a\"}", wantTo: recorded, wantResume: true},
+		{name: "other end", query: "{job=\"a\"}", to: from.Add(2 * time.Hour), wantTo: from.Add(2 * time.Hour)},
+		{name: "other query", query: "{job=\"b\"}", to: recorded, wantTo: recorded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+			first, err := New(Options{Query: "{job=\"a\"}", From: from, To: recorded, StateFile: stateFile}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first.state.Shards[0].Done = true
+			if err := first.saveLocked(); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := New(Options{Query: tt.query, From: from, To: tt.to, StateFile: stateFile}, nil)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if !b.opts.To.Equal(tt.wantTo) {
+				t.Errorf("To = %v, want %v", b.opts.To, tt.wantTo)
+			}
+			if resumed := b.state.Shards[0].Done; resumed != tt.wantResume {
+				t.Errorf("resumed = %v, want %v", resumed, tt.wantResume)
+			}
+		})
+	}
+}
+
+func TestEndDefaultsToNow(t *testing.T) {
+	from := time.Now().Add(-90 * time.Minute)
+	b, err := New(Options{Query: "{job=\"a\"}", From: from, StateFile: filepath.Join(t.TempDir(), "state.json")}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if since := time.Since(b.opts.To); since < 0 || since > time.Minute {
+		t.Errorf("To = %v, want now", b.opts.To)
+	}
+	if len(b.state.Shards) != 2 {
+		t.Errorf("got %d shards, want 2", len(b.state.Shards))
+	}
+}
@@ -0,0 +1,121 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store records the watermark of each pipeline.
+type Store interface {
+	// Load returns the watermark for key, if any.
+	Load(key string) (time.Time, bool, error)
+	// Save records t as the watermark for key.
+	Save(key string, t time.Time) error
+}
+
+// FileStore keeps all watermarks in a JSON file rewritten atomically.
+type FileStore struct {
+	path       string
+	mutex      sync.Mutex
+	watermarks map[string]time.Time
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:       path,
+		watermarks: make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %v", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(data, &s.watermarks); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %v", path, err)
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Load(key string) (time.Time, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.watermarks[key]
+	return t, ok, nil
+}
+
+func (s *FileStore) Save(key string, t time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.watermarks[key] = t.UTC()
+	return s.writeLocked()
+}
+
+// Rename moves the watermark of from to to, unless to has one.
+func (s *FileStore) Rename(from, to string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.watermarks[from]
+	if !ok || from == to {
+		return false, nil
+	}
+	if _, exists := s.watermarks[to]; exists {
+		return false, nil
+	}
+	s.watermarks[to] = t
+	delete(s.watermarks, from)
+	if err := s.writeLocked(); err != nil {
+		delete(s.watermarks, to)
+		s.watermarks[from] = t
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *FileStore) writeLocked() error {
+	data, err := json.MarshalIndent(s.watermarks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %v", err)
+	}
+
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create checkpoint directory: %v", err)
+		}
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint file: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync checkpoint file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %v", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint file: %v", err)
+	}
+	return nil
+}
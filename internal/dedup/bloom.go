@@ -0,0 +1,150 @@
+package dedup
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// bloomFilter is a fixed-size Bloom filter using double hashing over FNV-1a.
+type bloomFilter struct {
+	bits    []uint64
+	m       uint64
+	k       uint64
+	entries int64
+	start   time.Time
+}
+
+func newBloomFilter(m, k uint64, start time.Time) *bloomFilter {
+	return &bloomFilter{
+		bits:  make([]uint64, (m+63)/64),
+		m:     m,
+		k:     k,
+		start: start,
+	}
+}
+
+func (f *bloomFilter) positions(key string, fn func(pos uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1 := sum & 0xffffffff
+	h2 := sum>>32 | 1
+	for i := uint64(0); i < f.k; i++ {
+		fn((h1 + i*h2) % f.m)
+	}
+}
+
+func (f *bloomFilter) contains(key string) bool {
+	found := true
+	f.positions(key, func(pos uint64) {
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+func (f *bloomFilter) add(key string) {
+	f.positions(key, func(pos uint64) {
+		f.bits[pos/64] |= 1 << (pos % 64)
+	})
+	f.entries++
+}
+
+// Bloom is a fixed-memory Store made of a ring of Bloom filters, one per
+// time bucket.
+type Bloom struct {
+	bucket  time.Duration
+	buckets int
+	m       uint64
+	k       uint64
+	now     func() time.Time
+
+	mutex   sync.Mutex
+	filters []*bloomFilter
+	lookups int64
+	hits    int64
+}
+
+// NewBloom sizes each bucket's filter for expectedPerBucket keys at fpRate.
+func NewBloom(expectedPerBucket int, fpRate float64, bucket time.Duration, buckets int) *Bloom {
+	if expectedPerBucket <= 0 {
+		expectedPerBucket = 1
+	}
+	n := float64(expectedPerBucket)
+	m := math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	return &Bloom{
+		bucket:  bucket,
+		buckets: buckets,
+		m:       uint64(m),
+		k:       uint64(k),
+		now:     time.Now,
+	}
+}
+
+func (b *Bloom) Contains(key string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.lookups++
+	b.rotateLocked(b.now())
+
+	for _, f := range b.filters {
+		if f.contains(key) {
+			b.hits++
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bloom) Mark(keys ...string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	current := b.rotateLocked(b.now())
+	for _, key := range keys {
+		current.add(key)
+	}
+}
+
+func (b *Bloom) Stats() Stats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var stats Stats
+	for _, f := range b.filters {
+		stats.Entries += f.entries
+		stats.MemoryBytes += int64(len(f.bits) * 8)
+	}
+	stats.Lookups = b.lookups
+	stats.Hits = b.hits
+	return stats
+}
+
+func (b *Bloom) Close() error {
+	return nil
+}
+
+// rotateLocked returns the current filter, starting a new one when due.
+func (b *Bloom) rotateLocked(now time.Time) *bloomFilter {
+	if n := len(b.filters); n > 0 && now.Sub(b.filters[n-1].start) < b.bucket {
+		return b.filters[n-1]
+	}
+
+	b.filters = append(b.filters, newBloomFilter(b.m, b.k, now.Truncate(b.bucket)))
+	if len(b.filters) > b.buckets {
+		b.filters = b.filters[len(b.filters)-b.buckets:]
+	}
+
+	// After an idle period some buckets may be older than the ring covers
+	oldest := now.Add(-time.Duration(b.buckets) * b.bucket)
+	for len(b.filters) > 1 && b.filters[0].start.Before(oldest) {
+		b.filters = b.filters[1:]
+	}
+	return b.filters[len(b.filters)-1]
+}
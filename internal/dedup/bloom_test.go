@@ -0,0 +1,94 @@
+package dedup
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBloomExpiry(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		// idle skips the lookups in between
+		idle bool
+		want bool
+	}{
+		{name: "same bucket", after: 0, want: true},
+		{name: "next bucket", after: time.Minute, want: true},
+		{name: "last bucket of the ring", after: 3*time.Minute + 59*time.Second, want: true},
+		{name: "rotated out of the ring", after: 4 * time.Minute, want: false},
+		{name: "after an idle period", after: 3 * time.Minute, idle: true, want: true},
+		{name: "rotated out after an idle period", after: time.Hour, idle: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBloom(1000, 0.001, time.Minute, 4)
+			now := start
+			b.now = func() time.Time { return now }
+
+			if b.Contains("key") {
+				t.Fatalf("Contains() = true before Mark")
+			}
+			b.Mark("key")
+
+			// Lookups at every minute in between rotate the ring as the
+			// store would in use
+			for step := time.Minute; step < tt.after && !tt.idle; step += time.Minute {
+				now = start.Add(step)
+				b.Contains("other")
+			}
+			now = start.Add(tt.after)
+			if got := b.Contains("key"); got != tt.want {
+				t.Errorf("Contains() after %v = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	tests := []struct {
+		expected int
+		fpRate   float64
+	}{
+		{expected: 10000, fpRate: 0.01},
+		{expected: 10000, fpRate: 0.001},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.FormatFloat(tt.fpRate, 'f', -1, 64), func(t *testing.T) {
+			b := NewBloom(tt.expected, tt.fpRate, time.Hour, 1)
+			for i := 0; i < tt.expected; i++ {
+				b.Mark("marked-" + strconv.Itoa(i))
+			}
+			for i := 0; i < tt.expected; i++ {
+				if !b.Contains("marked-" + strconv.Itoa(i)) {
+					t.Fatalf("marked key %d not found", i)
+				}
+			}
+
+			falsePositives := 0
+			probes := 100000
+			for i := 0; i < probes; i++ {
+				if b.Contains("unmarked-" + strconv.Itoa(i)) {
+					falsePositives++
+				}
+			}
+			// Allow twice the target to keep the test stable
+			if rate := float64(falsePositives) / float64(probes); rate > 2*tt.fpRate {
+				t.Errorf("false positive rate = %v, want at most %v", rate, 2*tt.fpRate)
+			}
+
+			stats := b.Stats()
+			if stats.Entries != int64(tt.expected) {
+				t.Errorf("Stats().Entries = %d, want %d", stats.Entries, tt.expected)
+			}
+			if stats.Hits != int64(tt.expected+falsePositives) {
+				t.Errorf("Stats().Hits = %d, want %d", stats.Hits, tt.expected+falsePositives)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package dedup
+
+import (
+	"fmt"
+	"time"
+)
+
+// Store remembers the keys of records that were already shipped.
+type Store interface {
+	// Contains reports whether key was recorded.
+	Contains(key string) bool
+	// Mark records keys as shipped.
+	Mark(keys ...string)
+	// Stats returns a snapshot of the store counters.
+	Stats() Stats
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Stats describes the size and effectiveness of a Store.
+type Stats struct {
+	Entries     int64
+	MemoryBytes int64
+	Lookups     int64
+	Hits        int64
+}
+
+// HitRate returns the fraction of lookups that found a duplicate.
+func (s Stats) HitRate() float64 {
+	if s.Lookups == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Lookups)
+}
+
+// Options selects and sizes a Store implementation.
+type Options struct {
+	// Type is "memory" (TTL/LRU map, the default), "bloom" or "disk"
+	Type       string
+	MaxEntries int
+	TTL        time.Duration
+	// Path is the backing file of the disk store
+	Path string
+	// Bucket and Buckets size the ring of Bloom filters
+	Bucket            time.Duration
+	Buckets           int
+	FalsePositiveRate float64
+}
+
+// New builds the Store described by opts.
+func New(opts Options) (Store, error) {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000000
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+
+	switch opts.Type {
+	case "", "memory":
+		return NewMemory(opts.MaxEntries, opts.TTL), nil
+	case "bloom":
+		buckets := opts.Buckets
+		if buckets <= 0 {
+			buckets = 4
+		}
+		bucket := opts.Bucket
+		if bucket <= 0 {
+			bucket = opts.TTL / time.Duration(buckets)
+		}
+		fpRate := opts.FalsePositiveRate
+		if fpRate <= 0 || fpRate >= 1 {
+			fpRate = 0.0001
+		}
+		return NewBloom(opts.MaxEntries/buckets, fpRate, bucket, buckets), nil
+	case "disk":
+		if opts.Path == "" {
+			return nil, fmt.Errorf("dedup path is required for the disk store")
+		}
+		return NewDisk(opts.Path, opts.MaxEntries, opts.TTL)
+	default:
+		return nil, fmt.Errorf("unknown dedup store type %q", opts.Type)
+	}
+}
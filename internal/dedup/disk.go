@@ -0,0 +1,177 @@
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Disk is a Memory store journaled to a file, so keys survive restarts.
+type Disk struct {
+	*Memory
+
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+	lines int
+}
+
+func NewDisk(path string, maxEntries int, ttl time.Duration) (*Disk, error) {
+	d := &Disk{
+		Memory: NewMemory(maxEntries, ttl),
+		path:   path,
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *Disk) Mark(keys ...string) {
+	d.Memory.Mark(keys...)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.appendLocked(keys, d.now()); err != nil {
+		// The keys are still kept in memory
+		log.Printf("Failed to journal dedup keys: %v", err)
+	}
+	if d.lines > 2*int(d.Memory.Stats().Entries)+1000 {
+		if err := d.compactLocked(); err != nil {
+			log.Printf("Failed to compact dedup journal: %v", err)
+		}
+	}
+}
+
+func (d *Disk) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+// load replays the journal into memory, skipping expired or malformed lines.
+func (d *Disk) load() error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open dedup journal: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		ts, key, ok := parseJournalLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		d.Memory.restore(key, ts)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read dedup journal: %v", err)
+	}
+	return nil
+}
+
+func (d *Disk) compact() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.compactLocked()
+}
+
+// compactLocked rewrites the journal with only the live entries.
+func (d *Disk) compactLocked() error {
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+
+	tmp := d.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create dedup journal: %v", err)
+	}
+
+	w := bufio.NewWriter(f)
+	lines := 0
+	d.Memory.snapshot(func(key string, seen time.Time) {
+		w.WriteString(formatJournalLine(key, seen))
+		lines++
+	})
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write dedup journal: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write dedup journal: %v", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return fmt.Errorf("failed to replace dedup journal: %v", err)
+	}
+
+	d.file, err = os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dedup journal: %v", err)
+	}
+	d.lines = lines
+	return nil
+}
+
+func (d *Disk) appendLocked(keys []string, t time.Time) error {
+	if d.file == nil {
+		return fmt.Errorf("journal is closed")
+	}
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(formatJournalLine(key, t))
+	}
+	if _, err := d.file.WriteString(b.String()); err != nil {
+		return err
+	}
+	d.lines += len(keys)
+	return d.file.Sync()
+}
+
+func formatJournalLine(key string, t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10) + " " + strconv.Quote(key) + "\n"
+}
+
+func parseJournalLine(line string) (time.Time, string, bool) {
+	ts, quoted, ok := strings.Cut(line, " ")
+	if !ok {
+		return time.Time{}, "", false
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	key, err := strconv.Unquote(quoted)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, nanos), key, true
+}
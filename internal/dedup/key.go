@@ -0,0 +1,58 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+
+	"log-pipeline/internal/record"
+)
+
+// KeySpec describes which parts of a record identify it for deduplication.
+type KeySpec struct {
+	// Labels are Loki stream labels
+	Labels []string
+	// Fields are parsed record fields
+	Fields []string
+	// Timestamp includes the record time
+	Timestamp bool
+	// ContentHash includes the raw log line
+	ContentHash bool
+}
+
+// Key returns a digest of the parts of rec selected by the spec, or of its raw
+// line when none of them is present.
+func (s KeySpec) Key(rec *record.Record) string {
+	h := sha256.New()
+
+	present := s.Timestamp
+	for _, name := range s.Labels {
+		value, ok := rec.Labels[name]
+		writePart(h, "l", name, value, ok)
+		present = present || ok
+	}
+	for _, name := range s.Fields {
+		value, ok := rec.Fields.GetString(name)
+		writePart(h, "f", name, value, ok)
+		present = present || ok
+	}
+	if s.Timestamp {
+		writePart(h, "t", "", strconv.FormatInt(rec.Time.UnixNano(), 10), true)
+	}
+	if s.ContentHash || !present {
+		writePart(h, "c", "", rec.Raw, true)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func writePart(h hash.Hash, kind, name, value string, present bool) {
+	fmt.Fprintf(h, "%s%d:%s", kind, len(name), name)
+	if present {
+		fmt.Fprintf(h, "=%d:%s;", len(value), value)
+	} else {
+		h.Write([]byte("!;"))
+	}
+}
@@ -0,0 +1,88 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"log-pipeline/internal/record"
+)
+
+func TestKey(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	newRecord := func(raw string, fields map[string]interface{}) *record.Record {
+		rec := record.New(at, map[string]string{"job": "audit"}, raw)
+		for name, value := range fields {
+			rec.Fields.Set(name, value)
+		}
+		return rec
+	}
+	auditKey := KeySpec{Fields: []string{"computer", "event_record_id"}}
+
+	tests := []struct {
+		name string
+		spec KeySpec
+		a, b *record.Record
+		same bool
+	}{
+		{
+			name: "same fields, different lines",
+			spec: auditKey,
+			a:    newRecord("first", map[string]interface{}{"computer": "db1", "event_record_id": int64(7)}),
+			b:    newRecord("second", map[string]interface{}{"computer": "db1", "event_record_id": int64(7)}),
+			same: true,
+		},
+		{
+			name: "same record ID on another computer",
+			spec: auditKey,
+			a:    newRecord("line", map[string]interface{}{"computer": "db1", "event_record_id": int64(7)}),
+			b:    newRecord("line", map[string]interface{}{"computer": "db2", "event_record_id": int64(7)}),
+		},
+		{
+			name: "missing fields fall back to the line",
+			spec: auditKey,
+			a:    newRecord(`{"msg":"started"}`, nil),
+			b:    newRecord(`{"msg":"stopped"}`, nil),
+		},
+		{
+			name: "missing fields, same line",
+			spec: auditKey,
+			a:    newRecord(`{"msg":"started"}`, nil),
+			b:    newRecord(`{"msg":"started"}`, nil),
+			same: true,
+		},
+		{
+			name: "one field present is enough",
+			spec: auditKey,
+			a:    newRecord("first", map[string]interface{}{"computer": "db1"}),
+			b:    newRecord("second", map[string]interface{}{"computer": "db1"}),
+			same: true,
+		},
+		{
+			name: "missing is not empty",
+			spec: KeySpec{Fields: []string{"computer", "event_record_id"}, Timestamp: true},
+			a:    newRecord("line", map[string]interface{}{"computer": ""}),
+			b:    newRecord("line", nil),
+		},
+		{
+			name: "missing label falls back to the line",
+			spec: KeySpec{Labels: []string{"host"}},
+			a:    newRecord("first", nil),
+			b:    newRecord("second", nil),
+		},
+		{
+			name: "empty spec hashes the line",
+			a:    newRecord("line", map[string]interface{}{"computer": "db1"}),
+			b:    newRecord("line", map[string]interface{}{"computer": "db2"}),
+			same: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := tt.spec.Key(tt.a), tt.spec.Key(tt.b)
+			if (a == b) != tt.same {
+				t.Errorf("Key(a) == Key(b) is %v, want %v", a == b, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entryOverhead approximates the bytes used by one entry besides its key.
+const entryOverhead = 112
+
+type memoryEntry struct {
+	key  string
+	seen time.Time
+}
+
+// Memory is an in-memory Store bounded by entry count and by age.
+type Memory struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mutex    sync.Mutex
+	order    *list.List
+	entries  map[string]*list.Element
+	keyBytes int64
+	lookups  int64
+	hits     int64
+}
+
+func NewMemory(maxEntries int, ttl time.Duration) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (m *Memory) Contains(key string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	m.lookups++
+	m.expireLocked(now)
+
+	if elem, ok := m.entries[key]; ok {
+		m.hits++
+		elem.Value.(*memoryEntry).seen = now
+		m.order.MoveToFront(elem)
+		return true
+	}
+	return false
+}
+
+func (m *Memory) Mark(keys ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	m.expireLocked(now)
+	for _, key := range keys {
+		m.markLocked(key, now)
+	}
+}
+
+func (m *Memory) Stats() Stats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return Stats{
+		Entries:     int64(len(m.entries)),
+		MemoryBytes: m.keyBytes + int64(len(m.entries))*entryOverhead,
+		Lookups:     m.lookups,
+		Hits:        m.hits,
+	}
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// markLocked records key as seen at t.
+func (m *Memory) markLocked(key string, t time.Time) {
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*memoryEntry).seen = t
+		m.order.MoveToFront(elem)
+		return
+	}
+	m.addLocked(key, t)
+}
+
+// addLocked records key as seen at t, evicting the oldest entries if needed.
+func (m *Memory) addLocked(key string, t time.Time) {
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, seen: t})
+	m.keyBytes += int64(len(key))
+
+	for m.maxEntries > 0 && len(m.entries) > m.maxEntries {
+		m.removeLocked(m.order.Back())
+	}
+}
+
+// expireLocked drops every entry last seen more than ttl before now.
+func (m *Memory) expireLocked(now time.Time) {
+	for {
+		elem := m.order.Back()
+		if elem == nil || now.Sub(elem.Value.(*memoryEntry).seen) < m.ttl {
+			return
+		}
+		m.removeLocked(elem)
+	}
+}
+
+func (m *Memory) removeLocked(elem *list.Element) {
+	entry := m.order.Remove(elem).(*memoryEntry)
+	delete(m.entries, entry.key)
+	m.keyBytes -= int64(len(entry.key))
+}
+
+// snapshot calls fn for every live entry, oldest first.
+func (m *Memory) snapshot(fn func(key string, seen time.Time)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.expireLocked(m.now())
+	for elem := m.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*memoryEntry)
+		fn(entry.key, entry.seen)
+	}
+}
+
+// restore records key as seen at t when loading, oldest first.
+func (m *Memory) restore(key string, t time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.now().Sub(t) >= m.ttl {
+		return
+	}
+	m.markLocked(key, t)
+}
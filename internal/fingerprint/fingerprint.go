@@ -0,0 +1,272 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Result describes the shape of a SQL batch.
+type Result struct {
+	// Fingerprint is the normalized batch without literals or comments
+	Fingerprint string
+	// Hash is a short hash of Fingerprint for grouping
+	Hash string
+	// StatementType is the kind of the first statement, such as SELECT
+	StatementType string
+	// Objects are the tables, views and procedures the batch references
+	Objects []string
+}
+
+// Fingerprint normalizes a T-SQL batch.
+func Fingerprint(sql string) Result {
+	tokens := collapse(normalize(tokenize(sql)))
+	fp := join(tokens)
+	sum := sha256.Sum256([]byte(fp))
+
+	statementType := statementType(tokens)
+	return Result{
+		Fingerprint:   fp,
+		Hash:          hex.EncodeToString(sum[:8]),
+		StatementType: statementType,
+		Objects:       objects(tokens, statementType),
+	}
+}
+
+// normalize replaces literals with ? and lowercases everything else.
+func normalize(tokens []token) []string {
+	out := make([]string, 0, len(tokens))
+	for i, t := range tokens {
+		switch t.kind {
+		case stringToken, numberToken:
+			out = append(out, "?")
+		case punctToken:
+			if t.text == ";" || isSign(tokens, i) {
+				continue
+			}
+			out = append(out, t.text)
+		default:
+			out = append(out, strings.ToLower(t.text))
+		}
+	}
+	return out
+}
+
+// isSign reports whether tokens[i] is the sign of a number.
+func isSign(tokens []token, i int) bool {
+	if tokens[i].text != "-" && tokens[i].text != "+" {
+		return false
+	}
+	if i+1 >= len(tokens) || tokens[i+1].kind != numberToken {
+		return false
+	}
+	return i == 0 || tokens[i-1].kind == punctToken && tokens[i-1].text != ")"
+}
+
+// collapse reduces IN and VALUES lists of literals to (?+).
+func collapse(tokens []string) []string {
+	out := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		out = append(out, tokens[i])
+		switch tokens[i] {
+		case "in":
+			if end, ok := literalGroup(tokens, i+1); ok {
+				out = append(out, "(", "?+", ")")
+				i = end
+			}
+		case "values":
+			end, ok := literalGroup(tokens, i+1)
+			if !ok {
+				continue
+			}
+			for end+2 < len(tokens) && tokens[end+1] == "," {
+				next, ok := literalGroup(tokens, end+2)
+				if !ok {
+					break
+				}
+				end = next
+			}
+			out = append(out, "(", "?+", ")")
+			i = end
+		}
+	}
+	return out
+}
+
+// literalGroup returns the end of a parenthesized list of literals at start.
+func literalGroup(tokens []string, start int) (int, bool) {
+	if start >= len(tokens) || tokens[start] != "(" {
+		return 0, false
+	}
+	for i := start + 1; i < len(tokens); i += 2 {
+		if tokens[i] != "?" || i+1 >= len(tokens) {
+			return 0, false
+		}
+		switch tokens[i+1] {
+		case ")":
+			return i + 1, true
+		case ",":
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+func join(tokens []string) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && !noSpaceBefore(t) && !noSpaceAfter(tokens[i-1]) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+func noSpaceBefore(t string) bool {
+	return t == ")" || t == "," || t == "." || t == ":"
+}
+
+func noSpaceAfter(t string) bool {
+	return t == "(" || t == "." || t == ":"
+}
+
+var statementTypes = map[string]string{
+	"select":   "SELECT",
+	"insert":   "INSERT",
+	"update":   "UPDATE",
+	"delete":   "DELETE",
+	"merge":    "MERGE",
+	"create":   "DDL",
+	"alter":    "DDL",
+	"drop":     "DDL",
+	"truncate": "DDL",
+	"grant":    "DCL",
+	"revoke":   "DCL",
+	"deny":     "DCL",
+	"commit":   "TCL",
+	"rollback": "TCL",
+	"save":     "TCL",
+	"exec":     "EXEC",
+	"execute":  "EXEC",
+}
+
+func statementType(tokens []string) string {
+	for i, t := range tokens {
+		switch t {
+		case "(":
+			continue
+		case "with":
+			// The statement of a CTE follows its definitions
+			depth := 0
+			for _, t := range tokens[i+1:] {
+				switch t {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				case "select", "insert", "update", "delete", "merge":
+					if depth == 0 {
+						return statementTypes[t]
+					}
+				}
+			}
+			return "OTHER"
+		case "begin":
+			if i+1 < len(tokens) && (tokens[i+1] == "tran" || tokens[i+1] == "transaction") {
+				return "TCL"
+			}
+			return "OTHER"
+		}
+		if st, ok := statementTypes[t]; ok {
+			return st
+		}
+		return "OTHER"
+	}
+	return "OTHER"
+}
+
+// objectKeywords are followed by the name of a referenced object.
+var objectKeywords = map[string]bool{
+	"from":      true,
+	"join":      true,
+	"into":      true,
+	"update":    true,
+	"merge":     true,
+	"table":     true,
+	"view":      true,
+	"procedure": true,
+	"proc":      true,
+	"function":  true,
+	"trigger":   true,
+	"exec":      true,
+	"execute":   true,
+}
+
+func objects(tokens []string, statementType string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	index := false
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t == "index" {
+			index = true
+		}
+		// GRANT ... ON [OBJECT::]name and CREATE INDEX ... ON name
+		isOn := t == "on" && (statementType == "DCL" || index)
+		if !objectKeywords[t] && !isOn {
+			continue
+		}
+
+		j := i + 1
+		if isOn && j+2 < len(tokens) && tokens[j+1] == ":" && tokens[j+2] == ":" {
+			j += 3
+		}
+		name, end := qualifiedName(tokens, j)
+		if name == "" {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		i = end - 1
+	}
+	return names
+}
+
+// qualifiedName reads a multi-part name at start and the index past it.
+func qualifiedName(tokens []string, start int) (string, int) {
+	var parts []string
+	i := start
+	for i < len(tokens) && isIdentifier(tokens[i]) {
+		parts = append(parts, tokens[i])
+		i++
+		if i+1 < len(tokens) && tokens[i] == "." {
+			i++
+			continue
+		}
+		break
+	}
+	return strings.Join(parts, "."), i
+}
+
+func isIdentifier(t string) bool {
+	if t == "" || t == "?" || t == "?+" || reserved[t] {
+		return false
+	}
+	c := t[0]
+	return c == '_' || c == '#' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// reserved words are never object names.
+var reserved = map[string]bool{
+	"select": true, "from": true, "where": true, "set": true, "values": true,
+	"as": true, "on": true, "with": true, "table": true, "view": true,
+	"procedure": true, "proc": true, "function": true, "object": true,
+	"schema": true, "database": true, "login": true, "user": true,
+	"if": true, "exists": true, "not": true, "null": true, "default": true,
+	"top": true, "distinct": true, "inner": true, "outer": true, "left": true,
+	"right": true, "cross": true, "full": true, "join": true, "into": true,
+}
@@ -0,0 +1,133 @@
+package fingerprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name          string
+		sql           string
+		fingerprint   string
+		statementType string
+		objects       []string
+	}{
+		{
+			name:          "literals and case",
+			sql:           "SELECT * FROM dbo.Users WHERE id = 42 AND name = N'bob'",
+			fingerprint:   "select * from dbo.users where id = ? and name = ?",
+			statementType: "SELECT",
+			objects:       []string{"dbo.users"},
+		},
+		{
+			name:          "whitespace, escaped quotes and line comments",
+			sql:           "select *  from dbo.users where id=7 and name='al''ice' -- c",
+			fingerprint:   "select * from dbo.users where id = ? and name = ?",
+			statementType: "SELECT",
+			objects:       []string{"dbo.users"},
+		},
+		{
+			name:          "bracketed names and VALUES lists",
+			sql:           "INSERT INTO [dbo].[Orders] (a, b) VALUES (1, 'x'), (2, 'y'), (3, 'z')",
+			fingerprint:   "insert into dbo.orders (a, b) values (?+)",
+			statementType: "INSERT",
+			objects:       []string{"dbo.orders"},
+		},
+		{
+			name:          "IN lists and signed numbers",
+			sql:           "DELETE FROM t WHERE id IN (1, 2, 3, -4)",
+			fingerprint:   "delete from t where id in (?+)",
+			statementType: "DELETE",
+			objects:       []string{"t"},
+		},
+		{
+			name:          "block comments, hex and float literals",
+			sql:           "/* hi */ UPDATE s.t SET x = 0x1F WHERE y = -1.5e3",
+			fingerprint:   "update s.t set x = ? where y = ?",
+			statementType: "UPDATE",
+			objects:       []string{"s.t"},
+		},
+		{
+			name:          "joins",
+			sql:           "SELECT a FROM x JOIN y ON x.id = y.id",
+			fingerprint:   "select a from x join y on x.id = y.id",
+			statementType: "SELECT",
+			objects:       []string{"x", "y"},
+		},
+		{
+			name:          "procedure call",
+			sql:           "EXEC sp_who2 'active'",
+			fingerprint:   "exec sp_who2 ?",
+			statementType: "EXEC",
+			objects:       []string{"sp_who2"},
+		},
+		{
+			name:          "DDL",
+			sql:           "CREATE TABLE foo (id int)",
+			fingerprint:   "create table foo (id int)",
+			statementType: "DDL",
+			objects:       []string{"foo"},
+		},
+		{
+			name:          "DCL",
+			sql:           "GRANT SELECT ON dbo.t TO bob",
+			fingerprint:   "grant select on dbo.t to bob",
+			statementType: "DCL",
+			objects:       []string{"dbo.t"},
+		},
+		{
+			name:          "batch typed by its first statement",
+			sql:           "BEGIN TRAN; UPDATE a SET b = 1; COMMIT",
+			fingerprint:   "begin tran update a set b = ? commit",
+			statementType: "TCL",
+			objects:       []string{"a"},
+		},
+		{
+			name:          "empty batch",
+			sql:           "",
+			fingerprint:   "",
+			statementType: "OTHER",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Fingerprint(tt.sql)
+			if got.Fingerprint != tt.fingerprint {
+				t.Errorf("Fingerprint = %q, want %q", got.Fingerprint, tt.fingerprint)
+			}
+			if got.StatementType != tt.statementType {
+				t.Errorf("StatementType = %q, want %q", got.StatementType, tt.statementType)
+			}
+			if len(got.Objects) != 0 || len(tt.objects) != 0 {
+				if !reflect.DeepEqual(got.Objects, tt.objects) {
+					t.Errorf("Objects = %q, want %q", got.Objects, tt.objects)
+				}
+			}
+			if len(got.Hash) != 16 {
+				t.Errorf("Hash = %q, want 16 hex digits", got.Hash)
+			}
+		})
+	}
+}
+
+func TestFingerprintHashGroupsVariants(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"SELECT * FROM t WHERE id = 1", "select * from t where id = 999", true},
+		{"SELECT * FROM t WHERE id IN (1)", "SELECT * FROM t WHERE id IN (1, 2, 3)", true},
+		{"SELECT * FROM t WHERE id = -1", "SELECT * FROM t WHERE id = 1", true},
+		{"SELECT * FROM t WHERE id = 1", "SELECT * FROM u WHERE id = 1", false},
+		{"SELECT a FROM t", "SELECT b FROM t", false},
+	}
+
+	for _, tt := range tests {
+		a, b := Fingerprint(tt.a).Hash, Fingerprint(tt.b).Hash
+		if (a == b) != tt.same {
+			t.Errorf("Hash(%q) == Hash(%q) is %v, want %v", tt.a, tt.b, a == b, tt.same)
+		}
+	}
+}
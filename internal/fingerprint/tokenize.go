@@ -0,0 +1,118 @@
+package fingerprint
+
+import "strings"
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	numberToken
+	punctToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize splits T-SQL into words, literals and punctuation.
+func tokenize(sql string) []token {
+	var tokens []token
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		case c == '\'' || (c == 'N' || c == 'n') && i+1 < len(sql) && sql[i+1] == '\'':
+			if c != '\'' {
+				i++
+			}
+			i = skipQuoted(sql, i, '\'')
+			tokens = append(tokens, token{stringToken, "?"})
+		case c == '[':
+			end := skipQuoted(sql, i, ']')
+			tokens = append(tokens, token{wordToken, unquote(sql[i+1:end], "]]", "]")})
+			i = end
+		case c == '"':
+			end := skipQuoted(sql, i, '"')
+			tokens = append(tokens, token{wordToken, unquote(sql[i+1:end], `""`, `"`)})
+			i = end
+		case isDigit(c) || c == '.' && i+1 < len(sql) && isDigit(sql[i+1]):
+			end := i + 1
+			for end < len(sql) && (isWordChar(sql[end]) || sql[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{numberToken, sql[i:end]})
+			i = end
+		case isWordChar(c) || c == '@' || c == '#':
+			end := i + 1
+			for end < len(sql) && (isWordChar(sql[end]) || sql[end] == '@' || sql[end] == '#') {
+				end++
+			}
+			tokens = append(tokens, token{wordToken, sql[i:end]})
+			i = end
+		default:
+			tokens = append(tokens, token{punctToken, sql[i : i+1]})
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipQuoted returns the index past the quoted text opening at sql[start].
+func skipQuoted(sql string, start int, closing byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != closing {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == closing {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the index past the nested comment at sql[start].
+func skipBlockComment(sql string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(sql); i++ {
+		switch sql[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+func unquote(s, escaped, quote string) string {
+	if strings.HasSuffix(s, quote) {
+		s = s[:len(s)-1]
+	}
+	return strings.ReplaceAll(s, escaped, quote)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
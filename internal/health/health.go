@@ -1,13 +1,30 @@
 package health
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
+
+	"log-pipeline/internal/httpauth"
 )
 
+// DependencyStatus is the cached result of the last check of a dependency.
+type DependencyStatus struct {
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"lastCheck"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
 type HealthChecker struct {
 	httpClient *http.Client
+
+	mutex sync.RWMutex
+	// clients authenticate the checks of individual services, by URL
+	clients  map[string]*http.Client
+	checks   map[string]func() error
+	statuses map[string]DependencyStatus
 }
 
 func NewHealthChecker() *HealthChecker {
@@ -15,11 +32,38 @@ func NewHealthChecker() *HealthChecker {
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		clients:  make(map[string]*http.Client),
+		checks:   make(map[string]func() error),
+		statuses: make(map[string]DependencyStatus),
+	}
+}
+
+// SetAuth authenticates the health checks of the service at url.
+func (h *HealthChecker) SetAuth(url string, auth httpauth.Options) error {
+	client, err := httpauth.NewClient(auth, h.httpClient.Timeout)
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.clients[url] = client
+	return nil
+}
+
+func (h *HealthChecker) client(url string) *http.Client {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if client, ok := h.clients[url]; ok {
+		return client
 	}
+	return h.httpClient
 }
 
 func (h *HealthChecker) CheckLokiHealth(url string) error {
-	resp, err := h.httpClient.Get(fmt.Sprintf("%s/ready", url))
+	resp, err := h.client(url).Get(fmt.Sprintf("%s/ready", url))
 	if err != nil {
 		return fmt.Errorf("loki health check failed: %v", err)
 	}
@@ -32,7 +76,7 @@ func (h *HealthChecker) CheckLokiHealth(url string) error {
 }
 
 func (h *HealthChecker) CheckVictoriaHealth(url string) error {
-	resp, err := h.httpClient.Get(fmt.Sprintf("%s/health", url))
+	resp, err := h.client(url).Get(fmt.Sprintf("%s/health", url))
 	if err != nil {
 		return fmt.Errorf("victoria health check failed: %v", err)
 	}
@@ -43,3 +87,88 @@ func (h *HealthChecker) CheckVictoriaHealth(url string) error {
 	}
 	return nil
 }
+
+// WatchLoki adds the Loki at url to the dependencies checked by Watch.
+func (h *HealthChecker) WatchLoki(url string) {
+	h.watch("loki "+url, func() error { return h.CheckLokiHealth(url) })
+}
+
+// WatchVictoria adds the Victoria at url to the dependencies checked by Watch.
+func (h *HealthChecker) WatchVictoria(url string) {
+	h.watch("victoria "+url, func() error { return h.CheckVictoriaHealth(url) })
+}
+
+func (h *HealthChecker) watch(name string, check func() error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.checks[name] = check
+}
+
+// Watch checks every watched dependency each interval until ctx is done.
+func (h *HealthChecker) Watch(ctx context.Context, interval time.Duration) {
+	check := func() {
+		h.mutex.RLock()
+		checks := make(map[string]func() error, len(h.checks))
+		for name, check := range h.checks {
+			checks[name] = check
+		}
+		h.mutex.RUnlock()
+
+		for name, check := range checks {
+			h.record(name, check())
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+func (h *HealthChecker) record(name string, err error) {
+	status := DependencyStatus{Healthy: err == nil, LastCheck: time.Now()}
+	if err != nil {
+		status.LastError = err.Error()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.statuses[name] = status
+}
+
+// Statuses returns the cached status of every watched dependency.
+func (h *HealthChecker) Statuses() map[string]DependencyStatus {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	statuses := make(map[string]DependencyStatus, len(h.statuses))
+	for name, status := range h.statuses {
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// Ready reports whether every watched dependency passed its last check.
+func (h *HealthChecker) Ready() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if len(h.statuses) == 0 {
+		return false
+	}
+	for _, status := range h.statuses {
+		if !status.Healthy {
+			return false
+		}
+	}
+	return true
+}
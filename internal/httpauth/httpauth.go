@@ -0,0 +1,311 @@
+package httpauth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantHeader carries the Loki tenant, or several joined with "|".
+const TenantHeader = "X-Scope-OrgID"
+
+// Options configures how requests to a service are authenticated.
+type Options struct {
+	// Tenants are sent in TenantHeader
+	Tenants []string
+	// Username and Password enable basic auth
+	Username string
+	Password string
+	// BearerTokenFile holds a token sent as "Authorization: Bearer"
+	BearerTokenFile string
+	// Headers are added to every request
+	Headers map[string]string
+	TLS     TLSOptions
+}
+
+// Errors returned by Verifier.Verify.
+var (
+	ErrUnauthorized = errors.New("missing or invalid credentials")
+	ErrForbidden    = errors.New("tenant not allowed")
+)
+
+// TLSOptions configures server verification and client certificates.
+type TLSOptions struct {
+	// CAFile replaces the system roots used to verify the server
+	CAFile string
+	// CertFile and KeyFile hold the client certificate for mTLS
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// NewClient returns an HTTP client authenticating requests as opts describe.
+func NewClient(opts Options, timeout time.Duration) (*http.Client, error) {
+	t, err := newTransport(opts, http.DefaultTransport.(*http.Transport).Clone())
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t, Timeout: timeout}, nil
+}
+
+// NewStreamClient is NewClient without a timeout and over HTTP/1.1, for websockets.
+func NewStreamClient(opts Options) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ForceAttemptHTTP2 = false
+	base.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	t, err := newTransport(opts, base)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+func newTransport(opts Options, base *http.Transport) (*transport, error) {
+	tlsConfig, err := newTLSConfig(opts.TLS)
+	if err != nil {
+		return nil, err
+	}
+	base.TLSClientConfig = tlsConfig
+
+	if opts.Username != "" && opts.BearerTokenFile != "" {
+		return nil, fmt.Errorf("basic auth and a bearer token are mutually exclusive")
+	}
+
+	t := &transport{base: base, headers: make(http.Header)}
+	for name, value := range opts.Headers {
+		t.headers.Set(name, value)
+	}
+	if len(opts.Tenants) > 0 {
+		t.headers.Set(TenantHeader, strings.Join(opts.Tenants, "|"))
+	}
+	if opts.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(opts.Username + ":" + opts.Password))
+		t.headers.Set("Authorization", "Basic "+credentials)
+	}
+	if opts.BearerTokenFile != "" {
+		t.token = &watchedFile{path: opts.BearerTokenFile}
+		if _, err := t.token.read(); err != nil {
+			return nil, fmt.Errorf("failed to read bearer token: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// transport adds the configured headers to each request.
+type transport struct {
+	base    http.RoundTripper
+	headers http.Header
+	token   *watchedFile
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	if t.token != nil {
+		token, err := t.token.read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(token)))
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Verifier checks that a request carries the credentials and a tenant of its Options.
+type Verifier struct {
+	tenants  map[string]bool
+	username string
+	password string
+	token    *watchedFile
+}
+
+// NewVerifier returns a Verifier for opts.
+func NewVerifier(opts Options) (*Verifier, error) {
+	if opts.Username != "" && opts.BearerTokenFile != "" {
+		return nil, fmt.Errorf("basic auth and a bearer token are mutually exclusive")
+	}
+	if opts.Password != "" && opts.Username == "" {
+		return nil, fmt.Errorf("a password requires a username")
+	}
+
+	v := &Verifier{username: opts.Username, password: opts.Password}
+	for _, tenant := range opts.Tenants {
+		if v.tenants == nil {
+			v.tenants = make(map[string]bool)
+		}
+		v.tenants[tenant] = true
+	}
+	if opts.BearerTokenFile != "" {
+		v.token = &watchedFile{path: opts.BearerTokenFile}
+		if _, err := v.readToken(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Verify returns ErrUnauthorized or ErrForbidden when r is not allowed.
+func (v *Verifier) Verify(r *http.Request) error {
+	if v.username != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok || !equal(username, v.username) || !equal(password, v.password) {
+			return ErrUnauthorized
+		}
+	}
+	if v.token != nil {
+		token, err := v.readToken()
+		if err != nil {
+			return err
+		}
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") || !equal(header[len("Bearer "):], token) {
+			return ErrUnauthorized
+		}
+	}
+	if v.tenants != nil && !v.tenants[r.Header.Get(TenantHeader)] {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// readToken returns the expected bearer token, which must not be empty.
+func (v *Verifier) readToken() (string, error) {
+	token, err := v.token.read()
+	if err != nil {
+		return "", fmt.Errorf("failed to read bearer token: %v", err)
+	}
+	if len(bytes.TrimSpace(token)) == 0 {
+		return "", fmt.Errorf("bearer token file %s is empty", v.token.path)
+	}
+	return string(bytes.TrimSpace(token)), nil
+}
+
+// equal compares secrets in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func newTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		ca, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("a client certificate requires both certFile and keyFile")
+	}
+	if opts.CertFile != "" {
+		cert := &keyPair{cert: watchedFile{path: opts.CertFile}, key: watchedFile{path: opts.KeyFile}}
+		if _, err := cert.load(); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.load()
+		}
+	}
+
+	return config, nil
+}
+
+// keyPair is a client certificate reloaded when either file changes.
+type keyPair struct {
+	cert  watchedFile
+	key   watchedFile
+	mutex sync.Mutex
+	last  *tls.Certificate
+}
+
+func (k *keyPair) load() (*tls.Certificate, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	certChanged, certPEM, err := k.cert.changed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate: %v", err)
+	}
+	keyChanged, keyPEM, err := k.key.changed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client key: %v", err)
+	}
+	if k.last != nil && !certChanged && !keyChanged {
+		return k.last, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		// Keep the previous pair until both halves are replaced
+		if k.last != nil {
+			return k.last, nil
+		}
+		return nil, fmt.Errorf("invalid client certificate: %v", err)
+	}
+	k.last = &cert
+	return k.last, nil
+}
+
+// watchedFile caches a file until its size or modification time changes.
+type watchedFile struct {
+	path    string
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+func (f *watchedFile) read() ([]byte, error) {
+	_, data, err := f.changed()
+	return data, err
+}
+
+// changed returns the contents of the file and whether they were re-read.
+func (f *watchedFile) changed() (bool, []byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if f.data != nil {
+			// Keep using the last contents while the file is being replaced
+			return false, f.data, nil
+		}
+		return false, nil, err
+	}
+	if f.data != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, f.data, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if f.data != nil {
+			return false, f.data, nil
+		}
+		return false, nil, err
+	}
+	f.modTime, f.size, f.data = info.ModTime(), info.Size(), data
+	return true, data, nil
+}
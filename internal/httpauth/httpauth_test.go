@@ -0,0 +1,356 @@
+package httpauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes data to path with a modification time of version seconds
+// after the epoch, so that every rewrite is seen as a change.
+func writeFile(t *testing.T, path string, data []byte, version int) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(int64(version), 0)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newKeyPair returns a self-signed client certificate for commonName.
+func newKeyPair(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newServer starts a TLS server that stores the last request in got, and
+// returns its URL and TLS options trusting it. Keep-alives are off so that
+// every request makes a new handshake.
+func newServer(t *testing.T, clientAuth tls.ClientAuthType, got **http.Request) (string, TLSOptions) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*got = r
+	}))
+	server.TLS = &tls.Config{ClientAuth: clientAuth}
+	server.Config.SetKeepAlivesEnabled(false)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 1)
+	return server.URL, TLSOptions{CAFile: caFile}
+}
+
+func get(t *testing.T, client *http.Client, url string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestClientHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "single tenant",
+			opts: Options{Tenants: []string{"audit"}},
+			want: map[string]string{TenantHeader: "audit", "Authorization": ""},
+		},
+		{
+			name: "tenants are joined",
+			opts: Options{Tenants: []string{"audit", "ops"}},
+			want: map[string]string{TenantHeader: "audit|ops"},
+		},
+		{
+			name: "basic auth",
+			opts: Options{Username: "loki", Password: "secret"},
+			want: map[string]string{"Authorization": "Basic bG9raTpzZWNyZXQ=", TenantHeader: ""},
+		},
+		{
+			name: "extra headers",
+			opts: Options{Headers: map[string]string{"X-Source": "pipeline"}},
+			want: map[string]string{"X-Source": "pipeline"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			url, tlsOpts := newServer(t, tls.NoClientCert, &got)
+			tt.opts.TLS = tlsOpts
+			client, err := NewClient(tt.opts, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			get(t, client, url)
+
+			for name, value := range tt.want {
+				if got.Header.Get(name) != value {
+					t.Errorf("header %s = %q, want %q", name, got.Header.Get(name), value)
+				}
+			}
+		})
+	}
+}
+
+func TestBearerTokenReload(t *testing.T) {
+	var got *http.Request
+	url, tlsOpts := newServer(t, tls.NoClientCert, &got)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, []byte("first\n"), 1)
+
+	client, err := NewClient(Options{BearerTokenFile: tokenFile, TLS: tlsOpts}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name   string
+		update func()
+		want   string
+	}{
+		{"initial token", func() {}, "Bearer first"},
+		{"rotated token", func() { writeFile(t, tokenFile, []byte("second"), 2) }, "Bearer second"},
+		{"same size and time is not re-read", func() { writeFile(t, tokenFile, []byte("xxxxxx"), 2) }, "Bearer second"},
+		{"removed file keeps the last token", func() { os.Remove(tokenFile) }, "Bearer second"},
+	}
+	for _, step := range steps {
+		step.update()
+		get(t, client, url)
+		if auth := got.Header.Get("Authorization"); auth != step.want {
+			t.Errorf("%s: Authorization = %q, want %q", step.name, auth, step.want)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	var got *http.Request
+	url, tlsOpts := newServer(t, tls.RequireAnyClientCert, &got)
+	dir := t.TempDir()
+	tlsOpts.CertFile, tlsOpts.KeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	certA, keyA := newKeyPair(t, "a")
+	certB, keyB := newKeyPair(t, "b")
+	writeFile(t, tlsOpts.CertFile, certA, 1)
+	writeFile(t, tlsOpts.KeyFile, keyA, 1)
+
+	client, err := NewClient(Options{TLS: tlsOpts}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name   string
+		update func()
+		want   string
+	}{
+		{"initial pair", func() {}, "a"},
+		{"new certificate, old key keeps the last pair", func() { writeFile(t, tlsOpts.CertFile, certB, 2) }, "a"},
+		{"both halves replaced", func() { writeFile(t, tlsOpts.KeyFile, keyB, 2) }, "b"},
+		{"unreadable files keep the last pair", func() { os.Remove(tlsOpts.CertFile) }, "b"},
+	}
+	for _, step := range steps {
+		step.update()
+		get(t, client, url)
+		if cn := got.TLS.PeerCertificates[0].Subject.CommonName; cn != step.want {
+			t.Errorf("%s: client certificate = %q, want %q", step.name, cn, step.want)
+		}
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, _ := newKeyPair(t, "a")
+	certFile := filepath.Join(dir, "cert.pem")
+	writeFile(t, certFile, certPEM, 1)
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "basic auth and bearer token",
+			opts: Options{Username: "loki", BearerTokenFile: certFile},
+			want: "mutually exclusive",
+		},
+		{
+			name: "missing bearer token file",
+			opts: Options{BearerTokenFile: filepath.Join(dir, "missing")},
+			want: "failed to read bearer token",
+		},
+		{
+			name: "missing CA file",
+			opts: Options{TLS: TLSOptions{CAFile: filepath.Join(dir, "missing")}},
+			want: "failed to read CA file",
+		},
+		{
+			name: "certificate without a key",
+			opts: Options{TLS: TLSOptions{CertFile: certFile}},
+			want: "requires both certFile and keyFile",
+		},
+		{
+			name: "certificate and key do not match",
+			opts: Options{TLS: TLSOptions{CertFile: certFile, KeyFile: certFile}},
+			want: "invalid client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(tt.opts, time.Second); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewClient() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, []byte("secret\n"), 1)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		headers map[string]string
+		want    error
+	}{
+		{
+			name: "no credentials configured",
+			want: nil,
+		},
+		{
+			name:    "basic auth",
+			opts:    Options{Username: "push", Password: "secret"},
+			headers: map[string]string{"Authorization": "Basic cHVzaDpzZWNyZXQ="},
+		},
+		{
+			name:    "wrong password",
+			opts:    Options{Username: "push", Password: "secret"},
+			headers: map[string]string{"Authorization": "Basic cHVzaDpzZWNyZXU="},
+			want:    ErrUnauthorized,
+		},
+		{
+			name: "missing basic auth",
+			opts: Options{Username: "push", Password: "secret"},
+			want: ErrUnauthorized,
+		},
+		{
+			name:    "bearer token",
+			opts:    Options{BearerTokenFile: tokenFile},
+			headers: map[string]string{"Authorization": "Bearer secret"},
+		},
+		{
+			name:    "wrong bearer token",
+			opts:    Options{BearerTokenFile: tokenFile},
+			headers: map[string]string{"Authorization": "Bearer secret2"},
+			want:    ErrUnauthorized,
+		},
+		{
+			name:    "basic auth instead of a bearer token",
+			opts:    Options{BearerTokenFile: tokenFile},
+			headers: map[string]string{"Authorization": "Basic c2VjcmV0"},
+			want:    ErrUnauthorized,
+		},
+		{
+			name:    "allowed tenant",
+			opts:    Options{Tenants: []string{"audit", "ops"}},
+			headers: map[string]string{TenantHeader: "ops"},
+		},
+		{
+			name:    "other tenant",
+			opts:    Options{Tenants: []string{"audit", "ops"}},
+			headers: map[string]string{TenantHeader: "dev"},
+			want:    ErrForbidden,
+		},
+		{
+			name: "missing tenant",
+			opts: Options{Tenants: []string{"audit"}},
+			want: ErrForbidden,
+		},
+		{
+			name:    "joined tenants are not one of them",
+			opts:    Options{Tenants: []string{"audit", "ops"}},
+			headers: map[string]string{TenantHeader: "audit|ops"},
+			want:    ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if err := v.Verify(r); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifierEmptyToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	writeFile(t, tokenFile, []byte(" \n"), 1)
+
+	if _, err := NewVerifier(Options{BearerTokenFile: tokenFile}); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("NewVerifier() error = %v, want an empty token error", err)
+	}
+	if _, err := NewVerifier(Options{Password: "secret"}); err == nil || !strings.Contains(err.Error(), "requires a username") {
+		t.Errorf("NewVerifier() error = %v, want a missing username error", err)
+	}
+
+	writeFile(t, tokenFile, []byte("secret"), 2)
+	v, err := NewVerifier(Options{BearerTokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, tokenFile, nil, 3)
+	r := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	if err := v.Verify(r); err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Verify() with an emptied token file = %v, want a server error", err)
+	}
+}
@@ -1,56 +1,192 @@
 package loki
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"log-pipeline/internal/httpauth"
+	"log-pipeline/internal/metrics"
 	"log-pipeline/internal/resilience"
 )
 
+// DefaultLimit matches Loki's default max_entries_limit_per_query.
+const DefaultLimit = 5000
+
 type Client struct {
+	name       string
 	baseURL    string
 	httpClient *http.Client
-	maxRetries int
-	cb         *resilience.CircuitBreaker
+	// streamClient holds the tail websocket open
+	streamClient *http.Client
+	maxRetries   int
+	limit        int
+	cb           *resilience.CircuitBreaker
+}
+
+// Stream is one Loki stream with its [timestamp, line] pairs.
+type Stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]string        `json:"values"`
 }
 
 type LogResponse struct {
 	Data struct {
-		Result []struct {
-			Stream map[string]string `json:"stream"`
-			Values [][]string       `json:"values"`
-		} `json:"result"`
+		Result []Stream `json:"result"`
 	} `json:"data"`
+	// Stats describes how the window was fetched
+	Stats QueryStats `json:"-"`
 }
 
-func NewClient(baseURL string) *Client {
+// QueryStats reports the query_range pages and unique lines of a window.
+type QueryStats struct {
+	Pages int
+	Lines int
+}
+
+// NewClient creates a client for the Loki at baseURL.
+func NewClient(name, baseURL string, limit int, auth httpauth.Options) (*Client, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	httpClient, err := httpauth.NewClient(auth, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("loki client: %v", err)
+	}
+	streamClient, err := httpauth.NewStreamClient(auth)
+	if err != nil {
+		return nil, fmt.Errorf("loki client: %v", err)
+	}
 	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		maxRetries: 3,
-		cb:         resilience.NewCircuitBreaker("loki-client"),
+		name:         name,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   httpClient,
+		streamClient: streamClient,
+		maxRetries:   3,
+		limit:        limit,
+		cb:           resilience.NewCircuitBreaker("loki-" + name),
+	}, nil
+}
+
+// QueryLogs fetches every entry matching query in [start, end), page by page.
+func (c *Client) QueryLogs(ctx context.Context, query string, start, end time.Time) (*LogResponse, error) {
+	return c.SampleLogs(ctx, query, start, end, 0)
+}
+
+// SampleLogs is QueryLogs stopping after maxLines entries, unless it is 0.
+func (c *Client) SampleLogs(ctx context.Context, query string, start, end time.Time, maxLines int) (*LogResponse, error) {
+	result := &LogResponse{}
+	streams := make(map[string]int)
+
+	cursor := start.UnixNano()
+	var boundary map[string]bool
+	for cursor < end.UnixNano() {
+		page, err := c.queryPage(ctx, query, time.Unix(0, cursor), end)
+		if err != nil {
+			return nil, err
+		}
+		result.Stats.Pages++
+
+		lines, fresh := 0, 0
+		newest := cursor
+		for _, s := range page.Data.Result {
+			for _, v := range s.Values {
+				if ts, err := strconv.ParseInt(v[0], 10, 64); err == nil && ts > newest {
+					newest = ts
+				}
+			}
+		}
+
+		nextBoundary := make(map[string]bool)
+		if newest == cursor {
+			for id := range boundary {
+				nextBoundary[id] = true
+			}
+		}
+
+	entries:
+		for _, s := range page.Data.Result {
+			key := streamKey(s.Stream)
+			for _, v := range s.Values {
+				if len(v) < 2 {
+					continue
+				}
+				if maxLines > 0 && result.Stats.Lines+fresh >= maxLines {
+					break entries
+				}
+				lines++
+
+				id := key + "\x00" + v[0] + "\x00" + v[1]
+				if v[0] == strconv.FormatInt(newest, 10) {
+					nextBoundary[id] = true
+				}
+				if boundary[id] {
+					continue
+				}
+				fresh++
+
+				idx, ok := streams[key]
+				if !ok {
+					idx = len(result.Data.Result)
+					streams[key] = idx
+					result.Data.Result = append(result.Data.Result, Stream{Stream: s.Stream})
+				}
+				result.Data.Result[idx].Values = append(result.Data.Result[idx].Values, v)
+			}
+		}
+		result.Stats.Lines += fresh
+
+		// A short page means the window is exhausted
+		if lines < c.limit || maxLines > 0 && result.Stats.Lines >= maxLines {
+			break
+		}
+
+		if fresh == 0 {
+			// A full page shares one timestamp; skip past it
+			log.Printf("Loki returned %d entries at timestamp %d, some may be skipped; consider raising the query limit", lines, newest)
+			metrics.LokiSkippedTimestamps.Inc(c.name)
+			cursor = newest + 1
+			boundary = nil
+			continue
+		}
+
+		cursor = newest
+		boundary = nextBoundary
 	}
+
+	return result, nil
 }
 
-func (c *Client) QueryLogs(query string, start, end time.Time) (*LogResponse, error) {
+// queryPage runs a single forward query_range request.
+func (c *Client) queryPage(ctx context.Context, query string, start, end time.Time) (*LogResponse, error) {
 	operation := func() (*LogResponse, error) {
 		params := url.Values{}
 		params.Add("query", query)
 		params.Add("start", fmt.Sprintf("%d", start.UnixNano()))
 		params.Add("end", fmt.Sprintf("%d", end.UnixNano()))
+		params.Add("limit", strconv.Itoa(c.limit))
+		params.Add("direction", "forward")
 
 		url := fmt.Sprintf("%s/loki/api/v1/query_range?%s", c.baseURL, params.Encode())
 
 		// Execute request through circuit breaker
-		resp, err := c.cb.Execute(func() (interface{}, error) {
-			resp, err := c.httpClient.Get(url)
+		resp, err := c.cb.Execute(func() (_ interface{}, err error) {
+			defer func(start time.Time) { metrics.ObserveRequest(c.name, "loki", start, err) }(time.Now())
+
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create request: %v", err)
+			}
+
+			resp, err := c.httpClient.Do(req)
 			if err != nil {
 				return nil, fmt.Errorf("request failed: %v", err)
 			}
@@ -84,7 +220,8 @@ func (c *Client) QueryLogs(query string, start, end time.Time) (*LogResponse, er
 		var err error
 		result, err = operation()
 		return err
-	}, b, func(err error, duration time.Duration) {
+	}, backoff.WithContext(b, ctx), func(err error, duration time.Duration) {
+		metrics.Retries.Inc(c.name, "loki")
 		log.Printf("Retrying Loki query after %v due to error: %v", duration, err)
 	})
 
@@ -93,4 +230,31 @@ func (c *Client) QueryLogs(query string, start, end time.Time) (*LogResponse, er
 	}
 
 	return result, nil
-}
\ No newline at end of file
+}
+
+// BreakerState returns the state of the client's circuit breaker.
+func (c *Client) BreakerState() string {
+	return c.cb.State().String()
+}
+
+// streamKey returns a canonical string for a label set.
+func streamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"log-pipeline/internal/httpauth"
+	"log-pipeline/internal/metrics"
+)
+
+type entry struct {
+	stream string
+	ts     int64
+	line   string
+}
+
+// fakeLoki answers forward query_range requests from entries, which are in
+// timestamp order, capping each response at the requested limit as Loki does.
+func fakeLoki(t *testing.T, entries []entry) (*httptest.Server, *int) {
+	pages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/loki/api/v1/query_range" || q.Get("direction") != "forward" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		pages++
+
+		var resp LogResponse
+		streams := make(map[string]int)
+		n := 0
+		for _, e := range entries {
+			if e.ts < start || e.ts >= end || n == limit {
+				continue
+			}
+			n++
+			idx, ok := streams[e.stream]
+			if !ok {
+				idx = len(resp.Data.Result)
+				streams[e.stream] = idx
+				resp.Data.Result = append(resp.Data.Result, Stream{Stream: map[string]string{"job": e.stream}})
+			}
+			resp.Data.Result[idx].Values = append(resp.Data.Result[idx].Values, []string{strconv.FormatInt(e.ts, 10), e.line})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, &pages
+}
+
+// skippedTimestamps reads the skipped timestamps counter of pipeline.
+func skippedTimestamps(pipeline string) float64 {
+	var b bytes.Buffer
+	metrics.Default.Write(&b)
+	prefix := `log_pipeline_loki_skipped_timestamps_total{pipeline="` + pipeline + `"} `
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			value, _ := strconv.ParseFloat(line[len(prefix):], 64)
+			return value
+		}
+	}
+	return 0
+}
+
+func TestQueryLogsPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		maxLines int
+		entries  []entry
+		// want are the lines returned, per stream
+		want        map[string][]string
+		wantPages   int
+		wantSkipped float64
+	}{
+		{
+			name:  "single short page",
+			limit: 10,
+			entries: []entry{
+				{"a", 1, "a1"}, {"b", 2, "b2"}, {"a", 3, "a3"},
+			},
+			want:        map[string][]string{"a": {"a1", "a3"}, "b": {"b2"}},
+			wantPages:   1,
+			wantSkipped: 0,
+		},
+		{
+			name:  "boundary timestamp is not returned twice",
+			limit: 3,
+			entries: []entry{
+				{"a", 1, "a1"}, {"a", 2, "a2"}, {"b", 2, "b2"},
+				{"a", 3, "a3"}, {"b", 3, "b3"}, {"a", 4, "a4"},
+			},
+			want:        map[string][]string{"a": {"a1", "a2", "a3", "a4"}, "b": {"b2", "b3"}},
+			wantPages:   4,
+			wantSkipped: 0,
+		},
+		{
+			name:  "boundary timestamp spanning pages",
+			limit: 3,
+			entries: []entry{
+				{"a", 1, "a1"}, {"a", 2, "x"}, {"a", 3, "y"}, {"b", 3, "z"}, {"a", 4, "a4"},
+			},
+			want:        map[string][]string{"a": {"a1", "x", "y", "a4"}, "b": {"z"}},
+			wantPages:   3,
+			wantSkipped: 0,
+		},
+		{
+			name:  "more entries than the limit on one timestamp",
+			limit: 2,
+			entries: []entry{
+				{"a", 1, "a1"}, {"a", 2, "x"}, {"a", 2, "y"}, {"a", 2, "z"}, {"a", 3, "a3"},
+			},
+			// z is past the limit at timestamp 2 and is skipped
+			want:        map[string][]string{"a": {"a1", "x", "y", "a3"}},
+			wantPages:   4,
+			wantSkipped: 1,
+		},
+		{
+			name:  "as many entries as the limit on one timestamp",
+			limit: 2,
+			entries: []entry{
+				{"a", 1, "a1"}, {"a", 2, "x"}, {"a", 2, "y"}, {"a", 3, "a3"},
+			},
+			// Loki cannot tell whether more entries follow at timestamp 2
+			want:        map[string][]string{"a": {"a1", "x", "y", "a3"}},
+			wantPages:   4,
+			wantSkipped: 1,
+		},
+		{
+			name:     "paging stops at maxLines",
+			limit:    2,
+			maxLines: 3,
+			entries: []entry{
+				{"a", 1, "a1"}, {"a", 2, "a2"}, {"a", 3, "a3"}, {"a", 4, "a4"}, {"a", 5, "a5"},
+			},
+			want:        map[string][]string{"a": {"a1", "a2", "a3"}},
+			wantPages:   2,
+			wantSkipped: 0,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, pages := fakeLoki(t, tt.entries)
+			name := "pagination-" + strconv.Itoa(i)
+			client, err := NewClient(name, server.URL, tt.limit, httpauth.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			skipped := skippedTimestamps(name)
+
+			resp, err := client.SampleLogs(context.Background(), `{job=~".+"}`, time.Unix(0, 0), time.Unix(0, 100), tt.maxLines)
+			if err != nil {
+				t.Fatalf("SampleLogs() error = %v", err)
+			}
+
+			got := make(map[string][]string)
+			for _, s := range resp.Data.Result {
+				for _, v := range s.Values {
+					got[s.Stream["job"]] = append(got[s.Stream["job"]], v[1])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SampleLogs() = %v, want %v", got, tt.want)
+			}
+			lines := 0
+			for _, values := range tt.want {
+				lines += len(values)
+			}
+			if resp.Stats.Lines != lines || resp.Stats.Pages != *pages || *pages != tt.wantPages {
+				t.Errorf("Stats = %+v after %d requests, want %d lines in %d pages", resp.Stats, *pages, lines, tt.wantPages)
+			}
+			if got := skippedTimestamps(name) - skipped; got != tt.wantSkipped {
+				t.Errorf("skipped timestamps = %v, want %v", got, tt.wantSkipped)
+			}
+		})
+	}
+}
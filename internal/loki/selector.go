@@ -0,0 +1,162 @@
+package loki
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matcher is one label matcher of a stream selector.
+type Matcher struct {
+	Name string
+	// Op is "=", "!=", "=~" or "!~"
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// Selector is a LogQL stream selector such as {topic="audit", env!~"dev.*"}.
+type Selector []Matcher
+
+// ParseSelector parses the stream selector a LogQL query starts with.
+func ParseSelector(query string) (Selector, error) {
+	matchers, _, err := parseMatchers(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream selector %q: %v", query, err)
+	}
+	for i, m := range matchers {
+		if m.Op == "=~" || m.Op == "!~" {
+			// Loki anchors label regexes at both ends
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid stream selector %q: %v", query, err)
+			}
+			matchers[i].re = re
+		}
+	}
+	return matchers, nil
+}
+
+// ParseLabels parses a label set written as {name="value", ...}.
+func ParseLabels(s string) (map[string]string, error) {
+	matchers, rest, err := parseMatchers(s)
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = fmt.Errorf("unexpected %q after labels", rest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid labels %q: %v", s, err)
+	}
+	labels := make(map[string]string, len(matchers))
+	for _, m := range matchers {
+		if m.Op != "=" {
+			return nil, fmt.Errorf("invalid labels %q: %s is not a label value", s, m.Op)
+		}
+		labels[m.Name] = m.Value
+	}
+	return labels, nil
+}
+
+// Matches reports whether a stream with labels is selected.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, m := range s {
+		value := labels[m.Name]
+		var ok bool
+		switch m.Op {
+		case "=":
+			ok = value == m.Value
+		case "!=":
+			ok = value != m.Value
+		case "=~":
+			ok = m.re.MatchString(value)
+		case "!~":
+			ok = !m.re.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMatchers parses a {...} block of matchers and returns what follows it.
+func parseMatchers(s string) ([]Matcher, string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return nil, "", fmt.Errorf("expected {")
+	}
+	s = s[1:]
+
+	var matchers []Matcher
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if strings.HasPrefix(s, "}") {
+			return matchers, s[1:], nil
+		}
+		if len(matchers) > 0 {
+			if !strings.HasPrefix(s, ",") {
+				return nil, "", fmt.Errorf("expected , or }")
+			}
+			s = strings.TrimLeft(s[1:], " \t\n")
+			// A trailing comma is allowed
+			if strings.HasPrefix(s, "}") {
+				return matchers, s[1:], nil
+			}
+		}
+
+		n := 0
+		for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 0 && s[n] >= '0' && s[n] <= '9') {
+			n++
+		}
+		if n == 0 {
+			return nil, "", fmt.Errorf("expected a label name")
+		}
+		m := Matcher{Name: s[:n]}
+		s = strings.TrimLeft(s[n:], " \t\n")
+
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, op) {
+				m.Op = op
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, "", fmt.Errorf("expected an operator after %s", m.Name)
+		}
+		s = strings.TrimLeft(s[len(m.Op):], " \t\n")
+
+		value, rest, err := parseQuoted(s)
+		if err != nil {
+			return nil, "", fmt.Errorf("label %s: %v", m.Name, err)
+		}
+		m.Value, s = value, rest
+		matchers = append(matchers, m)
+	}
+}
+
+// parseQuoted parses a "double-quoted" or `raw` string at the start of s.
+func parseQuoted(s string) (string, string, error) {
+	if strings.HasPrefix(s, "`") {
+		end := strings.IndexByte(s[1:], '`')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("expected a quoted value")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", err
+			}
+			return value, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,85 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"log-pipeline/internal/metrics"
+)
+
+// TailResponse is one message of the tail websocket.
+type TailResponse struct {
+	Streams []Stream `json:"streams"`
+	// DroppedEntries are entries Loki could not send in time
+	DroppedEntries []DroppedEntry `json:"dropped_entries"`
+}
+
+// DroppedEntry identifies an entry left out of the tail stream.
+type DroppedEntry struct {
+	Labels map[string]string `json:"labels"`
+	// Timestamp is in Unix nanoseconds
+	Timestamp string `json:"timestamp"`
+}
+
+// TailStream is an open connection to the tail websocket.
+type TailStream struct {
+	conn *wsConn
+	done chan struct{}
+}
+
+// Tail subscribes to the entries matching query from start on.
+func (c *Client) Tail(ctx context.Context, query string, start time.Time, delayFor time.Duration) (*TailStream, error) {
+	params := url.Values{}
+	params.Add("query", query)
+	params.Add("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Add("limit", strconv.Itoa(c.limit))
+	if seconds := int(delayFor / time.Second); seconds > 0 {
+		params.Add("delay_for", strconv.Itoa(seconds))
+	}
+	url := fmt.Sprintf("%s/loki/api/v1/tail?%s", c.baseURL, params.Encode())
+
+	conn, err := c.cb.Execute(func() (_ interface{}, err error) {
+		defer func(start time.Time) { metrics.ObserveRequest(c.name, "loki", start, err) }(time.Now())
+		return dialWebsocket(ctx, c.streamClient, url)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tail: %v", err)
+	}
+
+	s := &TailStream{conn: conn.(*wsConn), done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.conn.Close()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// Next blocks until Loki sends the next message.
+func (s *TailStream) Next() (*TailResponse, error) {
+	message, err := s.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var resp TailResponse
+	if err := json.Unmarshal(message, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode tail message: %v", err)
+	}
+	return &resp, nil
+}
+
+// Close closes the stream.
+func (s *TailStream) Close() error {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	return s.conn.Close()
+}
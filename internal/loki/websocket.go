@@ -0,0 +1,253 @@
+package loki
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A minimal RFC 6455 websocket client for the Loki tail endpoint.
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+
+	// websocketGUID derives the accept header (RFC 6455 section 1.3)
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// maxMessageSize bounds a single reassembled message
+	maxMessageSize = 64 << 20
+
+	closeNormal = 1000
+)
+
+// CloseError is returned by ReadMessage once the server closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+type wsConn struct {
+	rwc io.ReadWriteCloser
+	br  *bufio.Reader
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+}
+
+// dialWebsocket upgrades a GET to rawURL to a websocket.
+func dialWebsocket(ctx context.Context, client *http.Client, rawURL string) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("websocket upgrade returned a read-only body")
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		rwc.Close()
+		return nil, fmt.Errorf("server upgraded to %q instead of websocket", resp.Header.Get("Upgrade"))
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		rwc.Close()
+		return nil, fmt.Errorf("server sent an invalid Sec-WebSocket-Accept")
+	}
+
+	return &wsConn{rwc: rwc, br: bufio.NewReader(rwc)}, nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ReadMessage returns the next data message, reassembled from its fragments.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			closeErr := &CloseError{Code: 1005}
+			var echo []byte
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+				echo = payload[:2]
+			}
+			// Echo the close, then drop the connection
+			c.writeFrame(opClose, echo)
+			c.rwc.Close()
+			return nil, closeErr
+		case opText, opBinary:
+			if started {
+				return nil, fmt.Errorf("websocket: new message inside a fragmented one")
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, fmt.Errorf("websocket: continuation without a message")
+			}
+		default:
+			return nil, fmt.Errorf("websocket: unknown opcode %#x", opcode)
+		}
+
+		if len(message)+len(payload) > maxMessageSize {
+			return nil, fmt.Errorf("websocket: message larger than %d bytes", maxMessageSize)
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket: reserved bits set without an extension")
+	}
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, fmt.Errorf("websocket: frame larger than %d bytes", maxMessageSize)
+	}
+
+	// Servers must not mask, but unmasking costs nothing
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends a single unfragmented, masked frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.rwc.Write(frame)
+	return err
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *wsConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, closeNormal)
+		c.writeFrame(opClose, payload)
+		err = c.rwc.Close()
+	})
+	return err
+}
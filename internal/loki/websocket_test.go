@@ -0,0 +1,254 @@
+package loki
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeConn replays server frames and records what the client writes.
+type fakeConn struct {
+	*bytes.Reader
+	written bytes.Buffer
+	closed  bool
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) { return c.written.Write(p) }
+func (c *fakeConn) Close() error                { c.closed = true; return nil }
+
+func newTestConn(frames ...[]byte) (*wsConn, *fakeConn) {
+	fake := &fakeConn{Reader: bytes.NewReader(bytes.Join(frames, nil))}
+	return &wsConn{rwc: fake, br: bufio.NewReader(fake)}, fake
+}
+
+// frame encodes a server frame. A non-nil mask masks the payload.
+func frame(fin bool, opcode byte, payload string, mask []byte) []byte {
+	b := []byte{opcode}
+	if fin {
+		b[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if mask == nil {
+		return append(b, payload...)
+	}
+	b = append(b, mask...)
+	for i := 0; i < len(payload); i++ {
+		b = append(b, payload[i]^mask[i%4])
+	}
+	return b
+}
+
+// header encodes only a frame header announcing length bytes.
+func header(opcode byte, length uint64) []byte {
+	b := []byte{0x80 | opcode, 127}
+	return binary.BigEndian.AppendUint64(b, length)
+}
+
+type sentFrame struct {
+	opcode  byte
+	payload string
+}
+
+func TestReadMessage(t *testing.T) {
+	closePayload := func(code uint16, reason string) string {
+		return string(binary.BigEndian.AppendUint16(nil, code)) + reason
+	}
+	long := strings.Repeat("x", 300)
+
+	tests := []struct {
+		name     string
+		frames   [][]byte
+		want     []string
+		wantErr  string
+		wantSent []sentFrame
+	}{
+		{
+			name:   "single text frame",
+			frames: [][]byte{frame(true, opText, `{"streams":[]}`, nil)},
+			want:   []string{`{"streams":[]}`},
+		},
+		{
+			name:   "binary frame with a 16-bit length",
+			frames: [][]byte{frame(true, opBinary, long, nil)},
+			want:   []string{long},
+		},
+		{
+			name:   "masked frame is unmasked",
+			frames: [][]byte{frame(true, opText, "hello", []byte{1, 2, 3, 4})},
+			want:   []string{"hello"},
+		},
+		{
+			name: "fragments are reassembled",
+			frames: [][]byte{
+				frame(false, opText, "hel", nil),
+				frame(false, opContinuation, "lo ", nil),
+				frame(true, opContinuation, "world", nil),
+				frame(true, opText, "next", nil),
+			},
+			want: []string{"hello world", "next"},
+		},
+		{
+			name: "ping between fragments is answered",
+			frames: [][]byte{
+				frame(false, opText, "a", nil),
+				frame(true, opPing, "keepalive", nil),
+				frame(true, opContinuation, "b", nil),
+			},
+			want:     []string{"ab"},
+			wantSent: []sentFrame{{opPong, "keepalive"}},
+		},
+		{
+			name: "pong is ignored",
+			frames: [][]byte{
+				frame(true, opPong, "", nil),
+				frame(true, opText, "a", nil),
+			},
+			want: []string{"a"},
+		},
+		{
+			name:     "close is echoed",
+			frames:   [][]byte{frame(true, opClose, closePayload(1011, "internal error"), nil)},
+			wantErr:  "websocket closed with code 1011: internal error",
+			wantSent: []sentFrame{{opClose, closePayload(1011, "")}},
+		},
+		{
+			name:     "close without a code",
+			frames:   [][]byte{frame(true, opClose, "", nil)},
+			wantErr:  "websocket closed with code 1005",
+			wantSent: []sentFrame{{opClose, ""}},
+		},
+		{
+			name:    "fragmented control frame",
+			frames:  [][]byte{frame(false, opPing, "x", nil)},
+			wantErr: "invalid control frame",
+		},
+		{
+			name:    "oversize control frame",
+			frames:  [][]byte{frame(true, opPing, long, nil)},
+			wantErr: "invalid control frame",
+		},
+		{
+			name:    "oversize data frame",
+			frames:  [][]byte{header(opText, maxMessageSize+1)},
+			wantErr: "frame larger than",
+		},
+		{
+			name:    "oversize length with the high bit set",
+			frames:  [][]byte{header(opBinary, 1<<63)},
+			wantErr: "frame larger than",
+		},
+		{
+			name:    "continuation without a message",
+			frames:  [][]byte{frame(true, opContinuation, "x", nil)},
+			wantErr: "continuation without a message",
+		},
+		{
+			name: "new message inside a fragmented one",
+			frames: [][]byte{
+				frame(false, opText, "a", nil),
+				frame(true, opText, "b", nil),
+			},
+			wantErr: "new message inside a fragmented one",
+		},
+		{
+			name:    "reserved bits",
+			frames:  [][]byte{{0x80 | 0x40 | opText, 0}},
+			wantErr: "reserved bits",
+		},
+		{
+			name:    "unknown opcode",
+			frames:  [][]byte{frame(true, 0x3, "", nil)},
+			wantErr: "unknown opcode",
+		},
+		{
+			name:    "truncated payload",
+			frames:  [][]byte{frame(true, opText, "hello", nil)[:4]},
+			wantErr: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, fake := newTestConn(tt.frames...)
+
+			for _, want := range tt.want {
+				got, err := conn.ReadMessage()
+				if err != nil {
+					t.Fatalf("ReadMessage() error = %v", err)
+				}
+				if string(got) != want {
+					t.Fatalf("ReadMessage() = %q, want %q", got, want)
+				}
+			}
+			if tt.wantErr != "" {
+				_, err := conn.ReadMessage()
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadMessage() error = %v, want %q", err, tt.wantErr)
+				}
+			}
+
+			sent := readSent(t, fake.written.Bytes())
+			if len(sent) != len(tt.wantSent) {
+				t.Fatalf("sent %v, want %v", sent, tt.wantSent)
+			}
+			for i := range sent {
+				if sent[i] != tt.wantSent[i] {
+					t.Errorf("sent frame %d = %v, want %v", i, sent[i], tt.wantSent[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadMessageCloseError(t *testing.T) {
+	conn, fake := newTestConn(frame(true, opClose, string(binary.BigEndian.AppendUint16(nil, closeNormal)), nil))
+
+	_, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != closeNormal {
+		t.Fatalf("ReadMessage() error = %v, want a CloseError with code %d", err, closeNormal)
+	}
+	if !fake.closed {
+		t.Errorf("connection was not closed")
+	}
+}
+
+// readSent decodes the frames the client wrote, checking they are masked.
+func readSent(t *testing.T, b []byte) []sentFrame {
+	t.Helper()
+	conn, _ := newTestConn(b)
+	var sent []sentFrame
+	for {
+		head, err := conn.br.Peek(2)
+		if err != nil {
+			return sent
+		}
+		if head[1]&0x80 == 0 {
+			t.Errorf("client frame is not masked")
+		}
+		fin, opcode, payload, err := conn.readFrame()
+		if err != nil {
+			t.Fatalf("client wrote an invalid frame: %v", err)
+		}
+		if !fin {
+			t.Errorf("client frame is fragmented")
+		}
+		sent = append(sent, sentFrame{opcode, string(payload)})
+	}
+}
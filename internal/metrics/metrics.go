@@ -0,0 +1,300 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metric families in the Prometheus text format.
+type Registry struct {
+	mutex    sync.Mutex
+	families []family
+}
+
+type family interface {
+	write(w io.Writer)
+}
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.families = append(r.families, f)
+}
+
+// Write renders every registered family.
+func (r *Registry) Write(w io.Writer) {
+	r.mutex.Lock()
+	families := append([]family(nil), r.families...)
+	r.mutex.Unlock()
+
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// Handler serves the registry over HTTP.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// desc is the name, help text and label names shared by a metric family.
+type desc struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, d.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// labels renders the label set for labelValues and preformatted extra pairs.
+func (d desc) labels(labelValues []string, extra string) string {
+	var pairs []string
+	for i, name := range d.labelNames {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		pairs = append(pairs, name+`="`+escapeLabel(value)+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func labelKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// sortedKeys returns the keys of a series map in a stable order.
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a family of monotonically increasing counters.
+type CounterVec struct {
+	desc
+	mutex  sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec creates a counter family and registers it in Default.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labelNames: labelNames},
+		series: make(map[string]*counterSeries),
+	}
+	Default.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := labelKey(labelValues)
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: labelValues}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	keys := sortedKeys(c.series)
+	for _, k := range keys {
+		s := c.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(s.labelValues, ""), formatFloat(s.value))
+	}
+}
+
+// GaugeVec is a family of values that can go up and down.
+type GaugeVec struct {
+	desc
+	mutex  sync.Mutex
+	series map[string]*gaugeSeries
+}
+
+type gaugeSeries struct {
+	labelValues []string
+	value       float64
+	fn          func() float64
+}
+
+// NewGaugeVec creates a gauge family and registers it in Default.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc:   desc{name: name, help: help, kind: "gauge", labelNames: labelNames},
+		series: make(map[string]*gaugeSeries),
+	}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.series[labelKey(labelValues)] = &gaugeSeries{labelValues: labelValues, value: v}
+}
+
+// SetFunc makes the series report fn() on every scrape.
+func (g *GaugeVec) SetFunc(fn func() float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.series[labelKey(labelValues)] = &gaugeSeries{labelValues: labelValues, fn: fn}
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.writeHeader(w)
+	keys := sortedKeys(g.series)
+	for _, k := range keys {
+		s := g.series[k]
+		v := s.value
+		if s.fn != nil {
+			v = s.fn()
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labels(s.labelValues, ""), formatFloat(v))
+	}
+}
+
+// HistogramVec is a family of cumulative histograms with fixed buckets.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// DefBuckets suit request latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// ExponentialBuckets returns count buckets from start, growing by factor.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// NewHistogramVec creates a histogram family and registers it in Default.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	Default.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := labelKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	keys := sortedKeys(h.series)
+	for _, k := range keys {
+		s := h.series[k]
+		for i, upper := range h.buckets {
+			le := `le="` + formatFloat(upper) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, le), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(s.labelValues, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(s.labelValues, ""), s.count)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import "time"
+
+// Pipeline metrics, labelled by the pipeline they belong to.
+var (
+	LinesFetched = NewCounterVec("log_pipeline_lines_fetched_total",
+		"Log lines fetched from Loki.", "pipeline")
+	LinesProcessed = NewCounterVec("log_pipeline_lines_processed_total",
+		"Log lines processed and handed to the Victoria writer.", "pipeline")
+	LinesSkipped = NewCounterVec("log_pipeline_lines_skipped_total",
+		"Log lines skipped as duplicates.", "pipeline")
+	LinesFailed = NewCounterVec("log_pipeline_lines_failed_total",
+		"Log lines that failed to write.", "pipeline")
+	LinesRejected = NewCounterVec("log_pipeline_lines_rejected_total",
+		"Log lines rejected by a parser, transform or schema validation.", "pipeline")
+	TenantFallbacks = NewCounterVec("log_pipeline_tenant_fallbacks_total",
+		"Records with no routable Victoria tenant, written to the default tenant.", "pipeline")
+	TailDropped = NewCounterVec("log_pipeline_tail_dropped_entries_total",
+		"Entries Loki dropped from the tail stream, refetched with query_range.", "pipeline")
+	TailReconnects = NewCounterVec("log_pipeline_tail_reconnects_total",
+		"Times the Loki tail connection was reopened.", "pipeline")
+	LinesPushed = NewCounterVec("log_pipeline_lines_pushed_total",
+		"Log lines received on the push API.", "pipeline")
+	LokiSkippedTimestamps = NewCounterVec("log_pipeline_loki_skipped_timestamps_total",
+		"Timestamps with as many entries as the Loki query limit; any entries past the limit were skipped.", "pipeline")
+
+	WatermarkTimestamp = NewGaugeVec("log_pipeline_watermark_timestamp_seconds",
+		"End of the last window shipped successfully, as a Unix timestamp.", "pipeline")
+	WatermarkLag = NewGaugeVec("log_pipeline_watermark_lag_seconds",
+		"Seconds between now and the end of the last window shipped successfully.", "pipeline")
+	ScheduleBacklog = NewGaugeVec("log_pipeline_schedule_backlog_seconds",
+		"Seconds the next window ends before the latest time it could, while catching up.", "pipeline")
+	WindowDuration = NewHistogramVec("log_pipeline_window_duration_seconds",
+		"Time taken to fetch and ship one window.", DefBuckets, "pipeline")
+)
+
+// Client metrics, labelled by the pipeline and client.
+var (
+	RequestDuration = NewHistogramVec("log_pipeline_request_duration_seconds",
+		"Duration of HTTP requests to Loki and Victoria.", DefBuckets, "pipeline", "client", "outcome")
+	Retries = NewCounterVec("log_pipeline_retries_total",
+		"Requests retried after a failure.", "pipeline", "client")
+	CircuitBreakerState = NewGaugeVec("log_pipeline_circuit_breaker_state",
+		"Circuit breaker state: 0 closed, 1 half-open, 2 open.", "name")
+)
+
+// Push receiver metrics.
+var (
+	PushRequests = NewCounterVec("log_pipeline_push_requests_total",
+		"Push requests by outcome (success, invalid, unauthorized or error).", "outcome")
+	PushUnmatched = NewCounterVec("log_pipeline_push_unmatched_lines_total",
+		"Pushed log lines selected by no pipeline and discarded.")
+)
+
+// Victoria batch metrics.
+var (
+	BatchRecords = NewHistogramVec("log_pipeline_batch_records",
+		"Records per batch written to Victoria.", ExponentialBuckets(1, 4, 8))
+	BatchBytes = NewHistogramVec("log_pipeline_batch_bytes",
+		"Bytes per batch written to Victoria.", ExponentialBuckets(1024, 4, 8))
+)
+
+// ObserveRequest records the duration and outcome of a client request.
+func ObserveRequest(pipeline, client string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	RequestDuration.Observe(time.Since(start).Seconds(), pipeline, client, outcome)
+}
+
+// SetWatermark records the watermark of a pipeline and keeps its lag current.
+func SetWatermark(pipeline string, t time.Time) {
+	WatermarkTimestamp.Set(float64(t.UnixNano())/1e9, pipeline)
+	WatermarkLag.SetFunc(func() float64 {
+		return time.Since(t).Seconds()
+	}, pipeline)
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON parses a JSON object, flattening nested objects into dotted keys.
+type JSON struct{}
+
+func (JSON) Parse(input string) ([]Field, error) {
+	var fields []Field
+	if err := flatten("", []byte(input), &fields); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return fields, nil
+}
+
+// flatten appends the leaves of the object in data to fields in order.
+func flatten(prefix string, data []byte, fields *[]Field) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("not an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		if raw[0] == '{' {
+			if err := flatten(key, raw, fields); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var v interface{}
+		value := json.NewDecoder(bytes.NewReader(raw))
+		value.UseNumber()
+		if err := value.Decode(&v); err != nil {
+			return err
+		}
+		if n, ok := v.(json.Number); ok {
+			v = number(n)
+		}
+		*fields = append(*fields, Field{Key: key, Value: v})
+	}
+	_, err := dec.Token()
+	return err
+}
+
+func number(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
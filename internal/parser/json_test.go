@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Field
+		wantErr string
+	}{
+		{
+			name:  "keys in input order",
+			input: `{"zeta": "z", "alpha": "a", "mid": true}`,
+			want:  []Field{{"zeta", "z"}, {"alpha", "a"}, {"mid", true}},
+		},
+		{
+			name:  "nested objects are flattened in place",
+			input: `{"name": "x", "tags": {"Computer": "SQL01", "env": {"dc": "eu"}}, "fields": {"EventRecordID": 7}}`,
+			want: []Field{
+				{"name", "x"}, {"tags.Computer", "SQL01"}, {"tags.env.dc", "eu"}, {"fields.EventRecordID", int64(7)},
+			},
+		},
+		{
+			name:  "numbers, null and arrays",
+			input: `{"i": -3, "f": 1.5, "big": 1e400, "n": null, "list": ["a", {"b": 1}]}`,
+			want: []Field{
+				{"i", int64(-3)}, {"f", 1.5}, {"big", "1e400"}, {"n", nil},
+				{"list", []interface{}{"a", map[string]interface{}{"b": json.Number("1")}}},
+			},
+		},
+		{
+			name:  "empty object",
+			input: ` {} `,
+		},
+		{
+			name:    "not an object",
+			input:   `["a"]`,
+			wantErr: "not an object",
+		},
+		{
+			name:    "truncated",
+			input:   `{"a": {"b": 1}`,
+			wantErr: "invalid JSON",
+		},
+		{
+			name:    "plain text",
+			input:   `Login failed for user 'sa'`,
+			wantErr: "invalid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSON{}.Parse(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
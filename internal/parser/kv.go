@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyValue parses delimited "key<separator>value" pairs.
+type KeyValue struct {
+	separator string
+	delimiter string
+}
+
+func NewKeyValue(separator, delimiter string) *KeyValue {
+	if separator == "" {
+		separator = ":"
+	}
+	if delimiter == "" {
+		delimiter = "\n"
+	}
+	return &KeyValue{separator: separator, delimiter: delimiter}
+}
+
+func (p *KeyValue) Parse(input string) ([]Field, error) {
+	var fields []Field
+	for _, pair := range strings.Split(input, p.delimiter) {
+		parts := strings.SplitN(pair, p.separator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			continue
+		}
+		fields = append(fields, Field{Key: key, Value: strings.TrimSpace(parts[1])})
+	}
+	return fields, nil
+}
+
+// Logfmt parses space-separated key=value pairs.
+type Logfmt struct{}
+
+func (Logfmt) Parse(input string) ([]Field, error) {
+	var fields []Field
+	i := 0
+	for i < len(input) {
+		// Skip whitespace between pairs
+		for i < len(input) && (input[i] == ' ' || input[i] == '\t') {
+			i++
+		}
+		if i >= len(input) {
+			break
+		}
+
+		start := i
+		for i < len(input) && input[i] != '=' && input[i] != ' ' && input[i] != '\t' {
+			i++
+		}
+		key := input[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("empty logfmt key at offset %d", start)
+		}
+
+		if i >= len(input) || input[i] != '=' {
+			fields = append(fields, Field{Key: key, Value: true})
+			continue
+		}
+		i++
+
+		if i < len(input) && input[i] == '"' {
+			value, n, err := unquote(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid logfmt value for %q: %v", key, err)
+			}
+			fields = append(fields, Field{Key: key, Value: value})
+			i += n
+			continue
+		}
+
+		start = i
+		for i < len(input) && input[i] != ' ' && input[i] != '\t' {
+			i++
+		}
+		fields = append(fields, Field{Key: key, Value: input[start:i]})
+	}
+	return fields, nil
+}
+
+// unquote decodes the quoted string at the start of s and its length.
+func unquote(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("unterminated escape")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string")
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+
+	"log-pipeline/internal/record"
+)
+
+// Field is one parsed key/value pair, returned in input order.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Parser turns a log line, or part of one, into fields.
+type Parser interface {
+	Parse(input string) ([]Field, error)
+}
+
+// Options selects and configures a Parser.
+type Options struct {
+	// Type is "kv", "logfmt", "json", "regex" or "passthrough"
+	Type string
+	// Separator splits keys from values for "kv" (default ":")
+	Separator string
+	// Delimiter splits pairs for "kv" (default a newline)
+	Delimiter string
+	// Pattern is the regular expression with named groups for "regex"
+	Pattern string
+	// Field receives the input for "passthrough" (default "message")
+	Field string
+	// Source is the field to parse; the raw line is parsed if it is empty
+	Source string
+	// KeepSource keeps the Source field once it has been parsed
+	KeepSource bool
+}
+
+// New builds the Parser described by opts.
+func New(opts Options) (Parser, error) {
+	switch opts.Type {
+	case "", "kv":
+		return NewKeyValue(opts.Separator, opts.Delimiter), nil
+	case "logfmt":
+		return Logfmt{}, nil
+	case "json":
+		return JSON{}, nil
+	case "regex":
+		return NewRegex(opts.Pattern)
+	case "passthrough":
+		field := opts.Field
+		if field == "" {
+			field = "message"
+		}
+		return Passthrough{Field: field}, nil
+	default:
+		return nil, fmt.Errorf("unknown parser type %q", opts.Type)
+	}
+}
+
+// NewStage builds the parser described by opts as a record stage.
+func NewStage(opts Options) (*Stage, error) {
+	p, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Stage{Parser: p, Source: opts.Source, KeepSource: opts.KeepSource}, nil
+}
+
+// Passthrough stores the whole input in a single field.
+type Passthrough struct {
+	Field string
+}
+
+func (p Passthrough) Parse(input string) ([]Field, error) {
+	return []Field{{Key: p.Field, Value: input}}, nil
+}
+
+// Regex extracts the named groups of a regular expression.
+type Regex struct {
+	re *regexp.Regexp
+}
+
+func NewRegex(pattern string) (*Regex, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("regex parser requires a pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex parser pattern: %v", err)
+	}
+
+	named := false
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			named = true
+		}
+	}
+	if !named {
+		return nil, fmt.Errorf("regex parser pattern %q has no named groups", pattern)
+	}
+
+	return &Regex{re: re}, nil
+}
+
+func (r *Regex) Parse(input string) ([]Field, error) {
+	match := r.re.FindStringSubmatchIndex(input)
+	if match == nil {
+		return nil, fmt.Errorf("input does not match pattern %q", r.re.String())
+	}
+
+	var fields []Field
+	for i, name := range r.re.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		fields = append(fields, Field{Key: name, Value: input[match[2*i]:match[2*i+1]]})
+	}
+	return fields, nil
+}
+
+// Stage applies a Parser to the raw line or the Source field of a record.
+type Stage struct {
+	Parser     Parser
+	Source     string
+	KeepSource bool
+}
+
+func (s *Stage) Apply(rec *record.Record) error {
+	input := rec.Raw
+	if s.Source != "" {
+		value, ok := rec.Fields.GetString(s.Source)
+		if !ok {
+			return nil
+		}
+		input = value
+	}
+
+	fields, err := s.Parser.Parse(input)
+	if err != nil {
+		if s.Source != "" {
+			return fmt.Errorf("failed to parse %s: %v", s.Source, err)
+		}
+		return err
+	}
+
+	if s.Source != "" && !s.KeepSource {
+		rec.Fields.Delete(s.Source)
+	}
+	for _, field := range fields {
+		rec.Fields.Set(field.Key, field.Value)
+	}
+	return nil
+}
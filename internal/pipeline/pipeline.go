@@ -0,0 +1,382 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"log-pipeline/config"
+	"log-pipeline/internal/checkpoint"
+	"log-pipeline/internal/dedup"
+	"log-pipeline/internal/httpauth"
+	"log-pipeline/internal/loki"
+	"log-pipeline/internal/parser"
+	"log-pipeline/internal/processor"
+	"log-pipeline/internal/push"
+	"log-pipeline/internal/redact"
+	"log-pipeline/internal/schedule"
+	"log-pipeline/internal/schema"
+	"log-pipeline/internal/transform"
+	"log-pipeline/internal/victoria"
+)
+
+// Pipeline ships one Loki query to one Victoria destination with its own
+// clients, batcher, dedup store and stats.
+type Pipeline struct {
+	cfg            config.PipelineConfig
+	lokiClient     *loki.Client
+	victoriaClient *victoria.Client
+	tenants        victoria.TenantSelector
+	writer         victoria.Writer
+	dedup          dedup.Store
+	parsers        []*parser.Stage
+	transforms     []transform.Transform
+	schema         *schema.Schema
+	rejects        *schema.RejectFile
+	proc           *processor.Processor
+	// selector picks the pushed streams of a push-mode pipeline
+	selector loki.Selector
+}
+
+// Status is the state of a pipeline reported on /status.
+type Status struct {
+	processor.Status
+	Stats    map[string]int64  `json:"stats"`
+	Breakers map[string]string `json:"breakers"`
+}
+
+// New builds the pipeline described by cfg; checkpoints may be nil.
+func New(writeCtx context.Context, cfg config.PipelineConfig, checkpoints checkpoint.Store, schemas *schema.Registry) (*Pipeline, error) {
+	recordSchema, err := schemas.Get(cfg.Victoria.Schema, cfg.Victoria.SchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	dedupStore, err := dedup.New(dedup.Options{
+		Type:              cfg.Dedup.Type,
+		MaxEntries:        cfg.Dedup.MaxEntries,
+		TTL:               time.Duration(cfg.Dedup.TTL),
+		Path:              cfg.Dedup.Path,
+		Bucket:            time.Duration(cfg.Dedup.BloomBucket),
+		Buckets:           cfg.Dedup.BloomBuckets,
+		FalsePositiveRate: cfg.Dedup.FalsePositiveRate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parsers, transforms, err := NewStages(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var rejects *schema.RejectFile
+	if cfg.RejectFile != "" {
+		if rejects, err = schema.NewRejectFile(cfg.RejectFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var selector loki.Selector
+	if cfg.Loki.Mode == "push" {
+		if selector, err = loki.ParseSelector(cfg.Loki.Query); err != nil {
+			return nil, err
+		}
+	}
+
+	lokiClient, err := loki.NewClient(cfg.Name, cfg.Loki.URL, cfg.Loki.Limit, LokiAuth(cfg.Loki))
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := victoria.TenantSelector{
+		Field:      cfg.Victoria.Tenant.Field,
+		Label:      cfg.Victoria.Tenant.Label,
+		MaxTenants: cfg.Victoria.Tenant.MaxTenants,
+	}
+	for name, value := range cfg.Victoria.Tenant.Tenants {
+		tenant, err := victoria.ParseTenant(value)
+		if err != nil {
+			return nil, fmt.Errorf("victoria tenant %q: %v", name, err)
+		}
+		if tenants.Tenants == nil {
+			tenants.Tenants = make(map[string]victoria.Tenant)
+		}
+		tenants.Tenants[name] = tenant
+	}
+
+	p := &Pipeline{
+		cfg:        cfg,
+		lokiClient: lokiClient,
+		victoriaClient: victoria.NewClient(cfg.Name, cfg.Victoria.URL, victoria.FieldMapping{
+			MsgField:     cfg.Victoria.MsgField,
+			TimeField:    cfg.Victoria.TimeField,
+			StreamFields: cfg.Victoria.StreamFields,
+		}, victoria.Tenant{AccountID: cfg.Victoria.Tenant.AccountID, ProjectID: cfg.Victoria.Tenant.ProjectID}),
+		tenants:    tenants,
+		selector:   selector,
+		dedup:      dedupStore,
+		parsers:    parsers,
+		transforms: transforms,
+		schema:     recordSchema,
+		rejects:    rejects,
+	}
+	p.writer = p.newWriter(writeCtx)
+	p.proc = p.newProcessor(p.writer, checkpoints)
+
+	return p, nil
+}
+
+// LokiAuth returns the authentication options of a Loki.
+func LokiAuth(cfg config.LokiConfig) httpauth.Options {
+	auth := cfg.Auth
+	tenants := auth.Tenants
+	if auth.Tenant != "" {
+		tenants = append([]string{auth.Tenant}, tenants...)
+	}
+	return httpauth.Options{
+		Tenants:         tenants,
+		Username:        auth.Username,
+		Password:        auth.Password,
+		BearerTokenFile: auth.BearerTokenFile,
+		Headers:         auth.Headers,
+		TLS: httpauth.TLSOptions{
+			CAFile:             auth.TLS.CAFile,
+			CertFile:           auth.TLS.CertFile,
+			KeyFile:            auth.TLS.KeyFile,
+			ServerName:         auth.TLS.ServerName,
+			InsecureSkipVerify: auth.TLS.InsecureSkipVerify,
+		},
+	}
+}
+
+// NewStages builds the parser and transform stages of a pipeline.
+func NewStages(cfg config.PipelineConfig) ([]*parser.Stage, []transform.Transform, error) {
+	var parsers []*parser.Stage
+	for _, pc := range cfg.Parsers {
+		stage, err := parser.NewStage(parser.Options{
+			Type:       pc.Type,
+			Separator:  pc.Separator,
+			Delimiter:  pc.Delimiter,
+			Pattern:    pc.Pattern,
+			Field:      pc.Field,
+			Source:     pc.Source,
+			KeepSource: pc.KeepSource,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		parsers = append(parsers, stage)
+	}
+
+	var transforms []transform.Transform
+	for i, tc := range cfg.Transforms {
+		t, err := transform.New(transform.Options{
+			Op:       tc.Op,
+			Field:    tc.Field,
+			Fields:   tc.Fields,
+			To:       tc.To,
+			Label:    tc.Label,
+			Value:    tc.Value,
+			Template: tc.Template,
+			Type:     tc.Type,
+			Layout:   tc.Layout,
+			Timezone: tc.Timezone,
+			Redact: redact.Options{
+				Detectors: tc.Detectors,
+				Patterns:  tc.Patterns,
+				Action:    redact.Action(tc.Action),
+				Mask:      tc.Mask,
+				Key:       []byte(tc.Key),
+			},
+			KeyFile: tc.KeyFile,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("transform %d: %v", i, err)
+		}
+		transforms = append(transforms, t)
+	}
+
+	// The event time is extracted once every other transform has run
+	timestamp, err := transform.NewTimestamp(cfg.Timestamp.Field, cfg.Timestamp.Layouts, cfg.Timestamp.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("timestamp: %v", err)
+	}
+	transforms = append(transforms, timestamp)
+
+	return parsers, transforms, nil
+}
+
+func (p *Pipeline) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Pipeline) Config() config.PipelineConfig {
+	return p.cfg
+}
+
+// NewWorker returns a processor with its own writer and no checkpoints.
+func (p *Pipeline) NewWorker(writeCtx context.Context) *processor.Processor {
+	return p.newProcessor(p.newWriter(writeCtx), nil)
+}
+
+// newWriter returns a batcher, or a router when records pick their tenant.
+func (p *Pipeline) newWriter(writeCtx context.Context) victoria.Writer {
+	linger := time.Duration(p.cfg.BatchLinger)
+	if p.tenants.Dynamic() {
+		return victoria.NewRouter(writeCtx, p.victoriaClient, p.tenants, p.cfg.BatchSize, p.cfg.BatchMaxBytes, linger)
+	}
+	return victoria.NewBatcher(writeCtx, p.victoriaClient, p.cfg.BatchSize, p.cfg.BatchMaxBytes, linger)
+}
+
+func (p *Pipeline) newProcessor(writer victoria.Writer, checkpoints checkpoint.Store) *processor.Processor {
+	return processor.NewProcessor(processor.Options{
+		Name:        p.cfg.Name,
+		Query:       p.cfg.Loki.Query,
+		LokiClient:  p.lokiClient,
+		Writer:      writer,
+		Checkpoints: checkpoints,
+		Dedup:       p.dedup,
+		DedupKey: dedup.KeySpec{
+			Labels:      p.cfg.Dedup.Key.Labels,
+			Fields:      p.cfg.Dedup.Key.Fields,
+			Timestamp:   p.cfg.Dedup.Key.Timestamp,
+			ContentHash: p.cfg.Dedup.Key.ContentHash,
+		},
+		Parsers:    p.parsers,
+		Transforms: p.transforms,
+		Schema:     p.schema,
+		Rejects:    p.rejects,
+	})
+}
+
+// Run polls or tails Loki until ctx is done; push mode has nothing to run.
+func (p *Pipeline) Run(ctx context.Context) {
+	log.Printf("[%s] Starting pipeline with query: %s", p.cfg.Name, p.cfg.Loki.Query)
+	if p.cfg.Loki.Mode == "push" {
+		log.Printf("[%s] Push mode, receiving streams matching %s", p.cfg.Name, p.cfg.Loki.Query)
+		<-ctx.Done()
+		return
+	}
+	if p.cfg.Loki.Mode == "tail" {
+		log.Printf("[%s] Tail mode, checkpoint interval: %v, delay: %v", p.cfg.Name, time.Duration(p.cfg.Loki.Interval), time.Duration(p.cfg.Loki.TailDelay))
+		// The tail picks up where the gap fill ends, so there is no delay
+		fill := p.scheduler()
+		fill.Delay = 0
+		p.proc.Tail(ctx, fill, time.Duration(p.cfg.Loki.Interval), time.Duration(p.cfg.Loki.TailDelay))
+		return
+	}
+	log.Printf("[%s] Time window: %v, Interval: %v, Ingestion delay: %v, Max window: %v", p.cfg.Name,
+		time.Duration(p.cfg.TimeWindow), time.Duration(p.cfg.Loki.Interval), time.Duration(p.cfg.IngestionDelay), time.Duration(p.cfg.MaxWindow))
+
+	sched := p.scheduler()
+	interval := time.Duration(p.cfg.Loki.Interval)
+	for {
+		started := time.Now()
+		wait := interval
+
+		w, err := p.proc.NextWindow(sched)
+		switch {
+		case err != nil:
+			log.Printf("[%s] Error computing next window: %v", p.cfg.Name, err)
+		case w.Empty():
+		default:
+			if w.Backlog > 0 {
+				log.Printf("[%s] Processing logs from %v to %v, %v behind", p.cfg.Name, w.Start, w.End, w.Backlog.Round(time.Second))
+			} else {
+				log.Printf("[%s] Processing logs from %v to %v", p.cfg.Name, w.Start, w.End)
+			}
+
+			if err := p.proc.ProcessLogs(ctx, w.Start, w.End); err != nil {
+				log.Printf("[%s] Error processing logs: %v", p.cfg.Name, err)
+			} else if w.Backlog > 0 {
+				// Catch up with the next chunk straight away
+				wait = 0
+			}
+		}
+
+		// Windows start every interval however long the last one took
+		if wait -= time.Since(started); wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// scheduler returns the schedule of the pipeline's polling windows.
+func (p *Pipeline) scheduler() schedule.Scheduler {
+	return schedule.Scheduler{
+		Lookback:  time.Duration(p.cfg.TimeWindow),
+		Delay:     time.Duration(p.cfg.IngestionDelay),
+		MaxWindow: time.Duration(p.cfg.MaxWindow),
+	}
+}
+
+// PushTarget returns the push receiver target of a push-mode pipeline.
+func (p *Pipeline) PushTarget() push.Target {
+	return push.Target{Name: p.cfg.Name, Selector: p.selector, Push: p.push}
+}
+
+func (p *Pipeline) push(streams []loki.Stream) error {
+	if err := p.proc.Push(streams); err != nil {
+		return fmt.Errorf("failed to write pushed entries: %v", err)
+	}
+	return nil
+}
+
+// Drain ships whatever the linger timer has not shipped yet.
+func (p *Pipeline) Drain() {
+	if err := p.proc.Flush(); err != nil {
+		log.Printf("[%s] Failed to drain buffered records: %v", p.cfg.Name, err)
+	}
+}
+
+func (p *Pipeline) Close() error {
+	if p.rejects != nil {
+		if err := p.rejects.Close(); err != nil {
+			log.Printf("[%s] Failed to close reject file: %v", p.cfg.Name, err)
+		}
+	}
+	return p.dedup.Close()
+}
+
+// LogStats logs the pipeline counters.
+func (p *Pipeline) LogStats() {
+	processed, errors, skipped := p.proc.GetStats()
+	log.Printf("[%s] Stats - Processed: %d, Errors: %d, Skipped: %d, Rejected: %d",
+		p.cfg.Name, processed, errors, skipped, p.proc.Rejected())
+	seen := p.proc.DedupStats()
+	log.Printf("[%s] Dedup - Entries: %d, Memory: %d bytes, Hit rate: %.2f%%",
+		p.cfg.Name, seen.Entries, seen.MemoryBytes, seen.HitRate()*100)
+	batches := p.writer.Stats()
+	log.Printf("[%s] Victoria - Batches: %d, Records: %d, Bytes: %d, Failed batches: %d, Failed records: %d",
+		p.cfg.Name, batches.Batches, batches.Records, batches.Bytes, batches.FailedBatches, batches.FailedRecords)
+}
+
+func (p *Pipeline) Status() Status {
+	processed, errors, skipped := p.proc.GetStats()
+	breakers := map[string]string{
+		"loki":     p.lokiClient.BreakerState(),
+		"victoria": p.victoriaClient.BreakerState(),
+	}
+	for tenant, state := range p.victoriaClient.BreakerStates() {
+		if tenant != p.victoriaClient.Tenant() {
+			breakers["victoria-"+tenant.String()] = state
+		}
+	}
+	return Status{
+		Status: p.proc.Status(),
+		Stats: map[string]int64{
+			"processed": processed,
+			"errors":    errors,
+			"skipped":   skipped,
+			"rejected":  p.proc.Rejected(),
+		},
+		Breakers: breakers,
+	}
+}
@@ -1,170 +1,396 @@
 package processor
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"strconv"
-	"strings"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"log-pipeline/internal/models"
+	"log-pipeline/internal/checkpoint"
+	"log-pipeline/internal/dedup"
 	"log-pipeline/internal/loki"
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/parser"
+	"log-pipeline/internal/record"
+	"log-pipeline/internal/schedule"
+	"log-pipeline/internal/schema"
+	"log-pipeline/internal/transform"
 	"log-pipeline/internal/victoria"
 )
 
 type Processor struct {
-	lokiClient     *loki.Client
-	victoriaClient *victoria.Client
-	seen           map[int64]bool
-	mutex          sync.RWMutex
-	stats          struct {
+	name        string
+	query       string
+	lokiClient  *loki.Client
+	writer      victoria.Writer
+	checkpoints checkpoint.Store
+	dedup       dedup.Store
+	dedupKey    dedup.KeySpec
+	parsers     []*parser.Stage
+	transforms  []transform.Transform
+	schema      *schema.Schema
+	rejects     *schema.RejectFile
+	// pending holds the dedup keys of records not flushed yet
+	pendingMutex sync.Mutex
+	pending      map[string]struct{}
+	// pushMutex serializes pushes
+	pushMutex   sync.Mutex
+	statusMutex sync.RWMutex
+	status      Status
+	stats       struct {
 		processed int64
 		errors    int64
 		skipped   int64
+		rejected  int64
 	}
 }
 
-func NewProcessor(lokiClient *loki.Client, victoriaClient *victoria.Client) *Processor {
+// Status describes the progress of a Processor.
+type Status struct {
+	// LastAttempt is when the last window finished, successfully or not
+	LastAttempt time.Time `json:"lastAttempt"`
+	// LastFetch is when Loki last answered a window query
+	LastFetch time.Time `json:"lastFetch"`
+	// LastWrite is when Victoria last accepted a batch
+	LastWrite time.Time `json:"lastWrite"`
+	// Watermark is the end of the last window shipped successfully
+	Watermark time.Time `json:"watermark"`
+}
+
+// Options wires a Processor into its pipeline.
+type Options struct {
+	// Name identifies the pipeline in checkpoints and metrics
+	Name       string
+	Query      string
+	LokiClient *loki.Client
+	Writer     victoria.Writer
+	// Checkpoints may be nil, in which case watermarks are not persisted
+	Checkpoints checkpoint.Store
+	Dedup       dedup.Store
+	DedupKey    dedup.KeySpec
+	// Parsers extract fields from each entry, in order
+	Parsers []*parser.Stage
+	// Transforms rewrite each parsed record, in order
+	Transforms []transform.Transform
+	// Schema upgrades and validates each record; it may be nil
+	Schema *schema.Schema
+	// Rejects receives rejected records; when nil they are only logged
+	Rejects *schema.RejectFile
+}
+
+func NewProcessor(opts Options) *Processor {
 	return &Processor{
-		lokiClient:     lokiClient,
-		victoriaClient: victoriaClient,
-		seen:           make(map[int64]bool),
+		name:        opts.Name,
+		query:       opts.Query,
+		lokiClient:  opts.LokiClient,
+		writer:      opts.Writer,
+		checkpoints: opts.Checkpoints,
+		dedup:       opts.Dedup,
+		dedupKey:    opts.DedupKey,
+		parsers:     opts.Parsers,
+		transforms:  opts.Transforms,
+		schema:      opts.Schema,
+		rejects:     opts.Rejects,
+		pending:     make(map[string]struct{}),
+	}
+}
+
+// NextWindow returns the next window scheduled by s, starting at the watermark.
+func (p *Processor) NextWindow(s schedule.Scheduler) (schedule.Window, error) {
+	p.statusMutex.RLock()
+	watermark := p.status.Watermark
+	p.statusMutex.RUnlock()
+
+	if watermark.IsZero() && p.checkpoints != nil {
+		stored, ok, err := p.checkpoints.Load(p.name)
+		if err != nil {
+			return schedule.Window{}, fmt.Errorf("failed to load checkpoint: %v", err)
+		}
+		if ok {
+			watermark = stored
+			metrics.SetWatermark(p.name, watermark)
+			p.updateStatus(func(s *Status) { s.Watermark = watermark })
+		}
 	}
+
+	w := s.Next(watermark, time.Now())
+	metrics.ScheduleBacklog.Set(w.Backlog.Seconds(), p.name)
+	return w, nil
 }
 
-func (p *Processor) ProcessLogs(query string, startTime, endTime time.Time) error {
-	logs, err := p.lokiClient.QueryLogs(query, startTime, endTime)
+// ProcessLogs ships the logs in [startTime, endTime) and advances the watermark.
+func (p *Processor) ProcessLogs(ctx context.Context, startTime, endTime time.Time) error {
+	defer p.updateStatus(func(s *Status) { s.LastAttempt = time.Now() })
+	defer func(start time.Time) { metrics.WindowDuration.Observe(time.Since(start).Seconds(), p.name) }(time.Now())
+
+	processingErrors, err := p.fetch(ctx, startTime, endTime)
 	if err != nil {
-		p.stats.errors++
-		return fmt.Errorf("failed to query Loki: %v", err)
+		return err
 	}
 
-	var processingErrors []error
-	for _, result := range logs.Data.Result {
-		for _, value := range result.Values {
-			if err := p.processLogEntry(value, result.Stream); err != nil {
-				p.stats.errors++
-				processingErrors = append(processingErrors, err)
-			} else {
-				p.stats.processed++
-			}
-		}
+	// Ship whatever is still buffered so the window is fully written
+	if err := p.Flush(); err != nil {
+		atomic.AddInt64(&p.stats.errors, 1)
+		processingErrors = append(processingErrors, err)
 	}
 
 	if len(processingErrors) > 0 {
 		return fmt.Errorf("encountered %d errors while processing logs: %v", len(processingErrors), processingErrors)
 	}
 
-	return nil
+	return p.saveWatermark(endTime)
 }
 
-func (p *Processor) processLogEntry(value []string, stream map[string]string) error {
-	var logEntry models.LogEntry
-	if err := json.Unmarshal([]byte(value[1]), &logEntry); err != nil {
-		return fmt.Errorf("failed to unmarshal log entry: %v", err)
+// Push ships entries received on the push API and returns once they are written.
+func (p *Processor) Push(streams []loki.Stream) error {
+	p.pushMutex.Lock()
+	defer p.pushMutex.Unlock()
+	defer p.updateStatus(func(s *Status) { s.LastAttempt = time.Now() })
+
+	lines := 0
+	for _, s := range streams {
+		lines += len(s.Values)
 	}
+	p.updateStatus(func(s *Status) { s.LastFetch = time.Now() })
+	metrics.LinesPushed.Add(float64(lines), p.name)
 
-	if p.isDuplicate(logEntry.Fields.EventRecordID) {
-		p.stats.skipped++
-		return nil
+	processingErrors := p.processStreams(streams)
+	if err := p.Flush(); err != nil {
+		atomic.AddInt64(&p.stats.errors, 1)
+		processingErrors = append(processingErrors, err)
+	}
+	if len(processingErrors) > 0 {
+		return fmt.Errorf("encountered %d errors while processing logs: %v", len(processingErrors), processingErrors)
 	}
+	return nil
+}
 
-	parsedData, err := p.parseLogData(logEntry.Fields.Data)
-	if err != nil {
-		return fmt.Errorf("failed to parse log data: %v", err)
+// Flush ships the buffered records and then marks their dedup keys.
+func (p *Processor) Flush() error {
+	p.pendingMutex.Lock()
+	keys := make([]string, 0, len(p.pending))
+	for key := range p.pending {
+		keys = append(keys, key)
 	}
+	p.pendingMutex.Unlock()
 
-	victoriaData := map[string]interface{}{
-		"event_record_id":   logEntry.Fields.EventRecordID,
-		"timestamp":         logEntry.Timestamp,
-		"computer":          logEntry.Tags["Computer"],
-		"error_code":        parsedData.Error,
-		"severity":          parsedData.Severity,
-		"state":            parsedData.State,
-		"start_time":        parsedData.StartTime,
-		"trace_type":        parsedData.TraceType,
-		"event_class_desc":  parsedData.EventClassDesc,
-		"login_name":        parsedData.LoginName,
-		"host_name":         parsedData.HostName,
-		"text_data":         parsedData.TextData,
-		"application_name":  parsedData.AppName,
-		"database_name":     parsedData.DatabaseName,
-		"object_name":       parsedData.ObjectName,
-		"role_name":         parsedData.RoleName,
+	err := p.writer.Flush()
+	rejected, rejectErr := p.rejectWritten(p.writer.Rejected())
+	if err == nil {
+		err = rejectErr
+	}
+	if err != nil {
+		return err
 	}
 
-	if err := p.victoriaClient.SendLog(victoriaData); err != nil {
-		return fmt.Errorf("failed to send log to Victoria: %v", err)
+	var written []string
+	for _, key := range keys {
+		if !rejected[key] {
+			written = append(written, key)
+		}
+	}
+	if len(written) == 0 {
+		return nil
 	}
 
+	p.dedup.Mark(written...)
+	p.pendingMutex.Lock()
+	for _, key := range written {
+		delete(p.pending, key)
+	}
+	p.pendingMutex.Unlock()
 	return nil
 }
 
-func (p *Processor) isDuplicate(eventRecordID int64) bool {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+// rejectWritten rejects the records Victoria refused and unmarks their keys.
+func (p *Processor) rejectWritten(rejections []victoria.Rejection) (map[string]bool, error) {
+	keys := make(map[string]bool, len(rejections))
+	var first error
+	for _, r := range rejections {
+		keys[p.dedupKey.Key(r.Record)] = true
+		atomic.AddInt64(&p.stats.rejected, 1)
+		metrics.LinesRejected.Inc(p.name)
+		if err := p.reject(r.Record, r.Reason); err != nil && first == nil {
+			first = err
+		}
+	}
 
-	if p.seen[eventRecordID] {
+	p.pendingMutex.Lock()
+	for key := range keys {
+		delete(p.pending, key)
+	}
+	p.pendingMutex.Unlock()
+	return keys, first
+}
+
+// isDuplicate reports whether key was shipped or is pending.
+func (p *Processor) isDuplicate(key string) bool {
+	if p.dedup.Contains(key) {
 		return true
 	}
-	p.seen[eventRecordID] = true
-	return false
+	p.pendingMutex.Lock()
+	defer p.pendingMutex.Unlock()
+
+	_, ok := p.pending[key]
+	return ok
 }
 
-func (p *Processor) parseLogData(data string) (*models.ParsedData, error) {
-	lines := strings.Split(data, "\n")
-	parsed := &models.ParsedData{}
+// fetch hands the logs in [startTime, endTime) to the writer.
+func (p *Processor) fetch(ctx context.Context, startTime, endTime time.Time) ([]error, error) {
+	logs, err := p.lokiClient.QueryLogs(ctx, p.query, startTime, endTime)
+	if err != nil {
+		atomic.AddInt64(&p.stats.errors, 1)
+		return nil, fmt.Errorf("failed to query Loki: %v", err)
+	}
+	p.updateStatus(func(s *Status) { s.LastFetch = time.Now() })
+	log.Printf("[%s] Fetched %d lines in %d pages", p.name, logs.Stats.Lines, logs.Stats.Pages)
+	metrics.LinesFetched.Add(float64(logs.Stats.Lines), p.name)
 
-	for _, line := range lines {
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
+	return p.processStreams(logs.Data.Result), nil
+}
+
+// processStreams processes every entry of streams and counts the outcomes.
+func (p *Processor) processStreams(streams []loki.Stream) []error {
+	var processingErrors []error
+	for _, result := range streams {
+		for _, value := range result.Values {
+			outcome, err := p.processLogEntry(value, result.Stream)
+			switch {
+			case err != nil:
+				atomic.AddInt64(&p.stats.errors, 1)
+				metrics.LinesFailed.Inc(p.name)
+				processingErrors = append(processingErrors, err)
+			case outcome == entrySkipped:
+				atomic.AddInt64(&p.stats.skipped, 1)
+				metrics.LinesSkipped.Inc(p.name)
+			case outcome == entryRejected:
+				atomic.AddInt64(&p.stats.rejected, 1)
+				metrics.LinesRejected.Inc(p.name)
+			default:
+				atomic.AddInt64(&p.stats.processed, 1)
+				metrics.LinesProcessed.Inc(p.name)
+			}
 		}
+	}
+	return processingErrors
+}
+
+// saveWatermark records that everything before t has been shipped.
+func (p *Processor) saveWatermark(t time.Time) error {
+	if p.checkpoints != nil {
+		if err := p.checkpoints.Save(p.name, t); err != nil {
+			atomic.AddInt64(&p.stats.errors, 1)
+			return fmt.Errorf("failed to save checkpoint: %v", err)
+		}
+		metrics.SetWatermark(p.name, t)
+	}
+	p.updateStatus(func(s *Status) { s.Watermark = t })
+	return nil
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
+// entryOutcome is what happened to a processed log entry.
+type entryOutcome int
 
-		switch key {
-		case "Error":
-			if errCode, err := strconv.Atoi(value); err == nil {
-				parsed.Error = errCode
-			}
-		case "Severity":
-			if severity, err := strconv.Atoi(value); err == nil {
-				parsed.Severity = severity
-			}
-		case "State":
-			if state, err := strconv.Atoi(value); err == nil {
-				parsed.State = state
-			}
-		case "StartTime":
-			parsed.StartTime = value
-		case "TraceType":
-			parsed.TraceType = value
-		case "EventClassDesc":
-			parsed.EventClassDesc = value
-		case "LoginName":
-			parsed.LoginName = value
-		case "HostName":
-			parsed.HostName = value
-		case "TextData":
-			parsed.TextData = value
-		case "ApplicationName":
-			parsed.AppName = value
-		case "DatabaseName":
-			parsed.DatabaseName = value
-		case "ObjectName":
-			parsed.ObjectName = value
-		case "RoleName":
-			parsed.RoleName = value
+const (
+	entryWritten entryOutcome = iota
+	entrySkipped
+	entryRejected
+)
+
+// processLogEntry prepares and validates one entry and hands it to the writer.
+func (p *Processor) processLogEntry(value []string, stream map[string]string) (entryOutcome, error) {
+	rec, err := Prepare(value, stream, p.parsers, p.transforms)
+	if err != nil {
+		if rec == nil {
+			rec = record.New(time.Time{}, stream, "")
+		}
+		return entryRejected, p.reject(rec, err)
+	}
+
+	if p.schema != nil {
+		err := p.schema.Upgrade(rec)
+		if err == nil {
+			err = p.schema.Validate(rec)
+		}
+		if err != nil {
+			return entryRejected, p.reject(rec, err)
 		}
 	}
 
-	return parsed, nil
+	key := p.dedupKey.Key(rec)
+	if p.isDuplicate(key) {
+		return entrySkipped, nil
+	}
+
+	if err := p.writer.Add(rec); err != nil {
+		return entryWritten, fmt.Errorf("failed to send logs to Victoria: %v", err)
+	}
+	p.pendingMutex.Lock()
+	p.pending[key] = struct{}{}
+	p.pendingMutex.Unlock()
+
+	return entryWritten, nil
+}
+
+// Prepare parses and transforms a Loki entry into a record.
+func Prepare(value []string, stream map[string]string, parsers []*parser.Stage, transforms []transform.Transform) (*record.Record, error) {
+	rec, err := record.FromLoki(value, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range parsers {
+		if err := stage.Apply(rec); err != nil {
+			return rec, fmt.Errorf("failed to parse log entry: %v", err)
+		}
+	}
+	for _, t := range transforms {
+		if err := t.Apply(rec); err != nil {
+			return rec, fmt.Errorf("failed to transform log entry: %v", err)
+		}
+	}
+	return rec, nil
+}
+
+// reject hands a record that failed a stage or validation to the reject file.
+func (p *Processor) reject(rec *record.Record, reason error) error {
+	if p.rejects == nil {
+		log.Printf("[%s] Rejected record at %v: %v", p.name, rec.Time, reason)
+		return nil
+	}
+	return p.rejects.Write(p.name, rec, reason)
 }
 
 // GetStats returns the current processing statistics
 func (p *Processor) GetStats() (processed, errors, skipped int64) {
-	return p.stats.processed, p.stats.errors, p.stats.skipped
-}
\ No newline at end of file
+	return atomic.LoadInt64(&p.stats.processed), atomic.LoadInt64(&p.stats.errors), atomic.LoadInt64(&p.stats.skipped)
+}
+
+// Status returns the progress of the processor
+func (p *Processor) Status() Status {
+	p.statusMutex.RLock()
+	status := p.status
+	p.statusMutex.RUnlock()
+
+	status.LastWrite = p.writer.Stats().LastWrite
+	return status
+}
+
+func (p *Processor) updateStatus(update func(s *Status)) {
+	p.statusMutex.Lock()
+	defer p.statusMutex.Unlock()
+
+	update(&p.status)
+}
+
+// Rejected returns the number of records rejected by a stage or validation
+func (p *Processor) Rejected() int64 {
+	return atomic.LoadInt64(&p.stats.rejected)
+}
+
+// DedupStats returns the size and hit rate of the deduplication store
+func (p *Processor) DedupStats() dedup.Stats {
+	return p.dedup.Stats()
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"log-pipeline/internal/dedup"
+	"log-pipeline/internal/loki"
+	"log-pipeline/internal/record"
+	"log-pipeline/internal/victoria"
+)
+
+// fakeWriter records what was added; Flush fails with err, and rejects the
+// records whose raw line is listed in reject.
+type fakeWriter struct {
+	added    []string
+	buffered []*record.Record
+	err      error
+	reject   map[string]bool
+	rejected []victoria.Rejection
+}
+
+func (w *fakeWriter) Add(rec *record.Record) error {
+	w.added = append(w.added, rec.Raw)
+	w.buffered = append(w.buffered, rec)
+	return nil
+}
+
+func (w *fakeWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	for _, rec := range w.buffered {
+		if w.reject[rec.Raw] {
+			w.rejected = append(w.rejected, victoria.Rejection{Record: rec, Reason: errors.New("bad request")})
+		}
+	}
+	w.buffered = nil
+	return nil
+}
+
+func (w *fakeWriter) Rejected() []victoria.Rejection {
+	rejected := w.rejected
+	w.rejected = nil
+	return rejected
+}
+
+func (w *fakeWriter) Stats() victoria.BatcherStats { return victoria.BatcherStats{} }
+
+func pushed(lines ...string) []loki.Stream {
+	s := loki.Stream{Stream: map[string]string{"job": "test"}}
+	for i, line := range lines {
+		s.Values = append(s.Values, []string{strconv.Itoa(i + 1), line})
+	}
+	return []loki.Stream{s}
+}
+
+func TestPushDedup(t *testing.T) {
+	tests := []struct {
+		name     string
+		flushErr error
+		reject   map[string]bool
+		// wantErr is whether the first push fails
+		wantErr bool
+		// wantResent are the lines a second push of the same entries writes
+		wantResent []string
+		wantStored []string
+	}{
+		{
+			name:       "written records are skipped",
+			wantStored: []string{"a", "b", "c"},
+		},
+		{
+			name:     "records of a failed flush stay pending",
+			flushErr: errors.New("unavailable"),
+			wantErr:  true,
+		},
+		{
+			name:       "rejected records are not marked",
+			reject:     map[string]bool{"b": true},
+			wantResent: []string{"b"},
+			wantStored: []string{"a", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &fakeWriter{err: tt.flushErr, reject: tt.reject}
+			store := dedup.NewMemory(100, time.Hour)
+			p := NewProcessor(Options{Name: "test", Writer: w, Dedup: store})
+
+			err := p.Push(pushed("a", "b", "c"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Push() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := p.Rejected(); got != int64(len(tt.reject)) {
+				t.Errorf("Rejected() = %d, want %d", got, len(tt.reject))
+			}
+
+			for _, line := range []string{"a", "b", "c"} {
+				want := false
+				for _, stored := range tt.wantStored {
+					want = want || stored == line
+				}
+				if got := store.Contains(p.dedupKey.Key(record.New(time.Time{}, nil, line))); got != want {
+					t.Errorf("store contains %q = %v, want %v", line, got, want)
+				}
+			}
+
+			w.added, w.err, w.reject = nil, nil, nil
+			if err := p.Push(pushed("a", "b", "c")); err != nil {
+				t.Fatalf("second Push() error = %v", err)
+			}
+			if len(w.added) != len(tt.wantResent) {
+				t.Fatalf("second Push() wrote %q, want %q", w.added, tt.wantResent)
+			}
+			for i := range w.added {
+				if w.added[i] != tt.wantResent[i] {
+					t.Errorf("second Push() wrote %q, want %q", w.added, tt.wantResent)
+				}
+			}
+		})
+	}
+}
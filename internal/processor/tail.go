@@ -0,0 +1,170 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"log-pipeline/internal/loki"
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/schedule"
+)
+
+// Tail streams the logs from the Loki tail websocket until ctx is done,
+// filling the gap since the watermark first and checkpointing every interval.
+func (p *Processor) Tail(ctx context.Context, fill schedule.Scheduler, interval, delayFor time.Duration) {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+
+	for {
+		started := time.Now()
+		connected, err := p.tailOnce(ctx, fill, interval, delayFor)
+		if ctx.Err() != nil {
+			return
+		}
+		// Reset the backoff after a connection that held
+		if connected && time.Since(started) > time.Minute {
+			b.Reset()
+		}
+
+		wait := b.NextBackOff()
+		log.Printf("[%s] Tail interrupted: %v; reconnecting in %v", p.name, err, wait)
+		metrics.TailReconnects.Inc(p.name)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tailOnce fills the gap and tails until the connection fails.
+func (p *Processor) tailOnce(ctx context.Context, fill schedule.Scheduler, interval, delayFor time.Duration) (connected bool, err error) {
+	var end time.Time
+	for {
+		w, err := p.NextWindow(fill)
+		if err != nil {
+			return false, err
+		}
+		if err := p.ProcessLogs(ctx, w.Start, w.End); err != nil {
+			return false, fmt.Errorf("gap fill failed: %v", err)
+		}
+		end = w.End
+		if w.Backlog == 0 {
+			break
+		}
+	}
+
+	stream, err := p.lokiClient.Tail(ctx, p.query, end, delayFor)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+	log.Printf("[%s] Tailing from %v", p.name, end)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	messages := make(chan *loki.TailResponse)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			resp, err := stream.Next()
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case messages <- resp:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Loki has sent everything before released by now
+	watermark, released := end, time.Now().Add(-delayFor)
+	var processingErrors []error
+	for {
+		select {
+		case <-ctx.Done():
+			return true, p.checkpointTail(watermark, processingErrors)
+		case err := <-failed:
+			if cpErr := p.checkpointTail(watermark, processingErrors); cpErr != nil {
+				log.Printf("[%s] %v", p.name, cpErr)
+			}
+			return true, err
+		case <-ticker.C:
+			watermark, released = released, time.Now().Add(-delayFor)
+			if err := p.checkpointTail(watermark, processingErrors); err != nil {
+				return true, err
+			}
+			processingErrors = nil
+		case resp := <-messages:
+			p.updateStatus(func(s *Status) { s.LastFetch = time.Now() })
+			lines := 0
+			for _, s := range resp.Streams {
+				lines += len(s.Values)
+			}
+			metrics.LinesFetched.Add(float64(lines), p.name)
+			processingErrors = append(processingErrors, p.processStreams(resp.Streams)...)
+
+			if len(resp.DroppedEntries) > 0 {
+				errs, err := p.fillDropped(ctx, resp.DroppedEntries)
+				if err != nil {
+					return true, err
+				}
+				processingErrors = append(processingErrors, errs...)
+			}
+		}
+	}
+}
+
+// fillDropped fetches the entries Loki dropped from the tail.
+func (p *Processor) fillDropped(ctx context.Context, dropped []loki.DroppedEntry) ([]error, error) {
+	var oldest, newest int64
+	for _, entry := range dropped {
+		ts, err := strconv.ParseInt(entry.Timestamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		if oldest == 0 || ts < oldest {
+			oldest = ts
+		}
+		if ts > newest {
+			newest = ts
+		}
+	}
+	metrics.TailDropped.Add(float64(len(dropped)), p.name)
+	if oldest == 0 {
+		return nil, fmt.Errorf("loki dropped %d tail entries without valid timestamps", len(dropped))
+	}
+
+	start, end := time.Unix(0, oldest), time.Unix(0, newest+1)
+	log.Printf("[%s] Loki dropped %d tail entries, filling %v to %v", p.name, len(dropped), start, end)
+	errs, err := p.fetch(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fill dropped entries: %v", err)
+	}
+	return errs, nil
+}
+
+// checkpointTail flushes the writer and advances the watermark.
+func (p *Processor) checkpointTail(watermark time.Time, processingErrors []error) error {
+	defer p.updateStatus(func(s *Status) { s.LastAttempt = time.Now() })
+
+	if err := p.Flush(); err != nil {
+		atomic.AddInt64(&p.stats.errors, 1)
+		processingErrors = append(processingErrors, err)
+	}
+	if len(processingErrors) > 0 {
+		return fmt.Errorf("encountered %d errors while processing logs: %v", len(processingErrors), processingErrors)
+	}
+	return p.saveWatermark(watermark)
+}
@@ -0,0 +1,143 @@
+package push
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"log-pipeline/internal/loki"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// decodeProto decodes a logproto.PushRequest, skipping structured metadata.
+func decodeProto(b []byte) ([]loki.Stream, error) {
+	var streams []loki.Stream
+	err := eachField(b, func(num int, wire int, value uint64, data []byte) error {
+		if num != 1 || wire != wireBytes {
+			return nil
+		}
+		s, err := decodeStream(data)
+		if err != nil {
+			return err
+		}
+		streams = append(streams, s)
+		return nil
+	})
+	return streams, err
+}
+
+func decodeStream(b []byte) (loki.Stream, error) {
+	var s loki.Stream
+	var labels string
+	err := eachField(b, func(num int, wire int, value uint64, data []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			labels = string(data)
+		case num == 2 && wire == wireBytes:
+			entry, err := decodeEntry(data)
+			if err != nil {
+				return err
+			}
+			s.Values = append(s.Values, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+
+	s.Stream, err = loki.ParseLabels(labels)
+	return s, err
+}
+
+// decodeEntry returns an entry as a Loki [timestamp, line] pair.
+func decodeEntry(b []byte) ([]string, error) {
+	var seconds, nanos int64
+	var line string
+	err := eachField(b, func(num int, wire int, value uint64, data []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			return eachField(data, func(num int, wire int, value uint64, _ []byte) error {
+				switch {
+				case num == 1 && wire == wireVarint:
+					seconds = int64(value)
+				case num == 2 && wire == wireVarint:
+					nanos = int64(int32(value))
+				}
+				return nil
+			})
+		case num == 2 && wire == wireBytes:
+			line = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if seconds > math.MaxInt64/int64(time.Second)-1 || seconds < math.MinInt64/int64(time.Second)+1 {
+		return nil, fmt.Errorf("entry timestamp %ds out of range", seconds)
+	}
+	return []string{strconv.FormatInt(seconds*int64(time.Second)+nanos, 10), line}, nil
+}
+
+// eachField calls fn for every field of a message.
+func eachField(b []byte, fn func(num int, wire int, value uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("protobuf: invalid field key")
+		}
+		b = b[n:]
+		num, wire := int(key>>3), int(key&0x07)
+		if num == 0 {
+			return errors.New("protobuf: invalid field number 0")
+		}
+
+		var value uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("protobuf: invalid varint")
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errors.New("protobuf: truncated fixed64")
+			}
+			value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errors.New("protobuf: truncated fixed32")
+			}
+			value = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errors.New("protobuf: truncated field")
+			}
+			data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", wire)
+		}
+
+		if err := fn(num, wire, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
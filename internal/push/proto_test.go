@@ -0,0 +1,122 @@
+package push
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"log-pipeline/internal/loki"
+)
+
+// promtailPush is a snappy-compressed logproto.PushRequest as Promtail sends
+// it: two streams, an entry with zero nanoseconds, and an entry with
+// structured metadata.
+const promtailPush = "c401f0710a92010a2c7b66696c656e616d653d222f7661722f6c6f672f6170702e6c6f67222c206a6f623d227661726c" +
+	"6f6773227d12270a0b0880e2cfaa0610959aef3a12186c6576656c3d696e666f206d73673d22737461727465642212390a0608" +
+	"81e2cfaa06121b6c6576656c3d6572726f72200525886469736b2066756c6c221a120a0874726163655f696412066162633132" +
+	"330a2d0a0d7b0577906175646974227d121c0a080882e2cfaa06100512107b2275736572223a22616c696365227d"
+
+func TestDecodePromtailPush(t *testing.T) {
+	body, err := hex.DecodeString(promtailPush)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", Path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	got, err := NewHandler(nil, 1<<20, nil).decode(req)
+	if err != nil {
+		t.Fatalf("decode() error = %v", err)
+	}
+	want := []loki.Stream{
+		{
+			Stream: map[string]string{"filename": "/var/log/app.log", "job": "varlogs"},
+			Values: [][]string{
+				{"1700000000123456789", `level=info msg="started"`},
+				{"1700000001000000000", `level=error msg="disk full"`},
+			},
+		},
+		{
+			Stream: map[string]string{"job": "audit"},
+			Values: [][]string{
+				{"1700000002000000005", `{"user":"alice"}`},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decode() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeProto(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []loki.Stream
+		wantErr string
+	}{
+		{
+			name:    "empty request",
+			message: "",
+		},
+		{
+			name: "negative nanos and unknown fields",
+			// streams { labels: `{a="b"}` entries { timestamp { seconds: 2
+			// nanos: -1 } line: "x" } } plus fixed32 and fixed64 fields
+			message: "0a2b" + "0a077b613d2262227d" + "1220" + "0a0d080210ffffffffffffffffff01" + "120178" + "1d01000000" + "190100000000000000",
+			want: []loki.Stream{
+				{Stream: map[string]string{"a": "b"}, Values: [][]string{{"1999999999", "x"}}},
+			},
+		},
+		{
+			name:    "invalid labels",
+			message: "0a050a03666f6f",
+			wantErr: "invalid labels",
+		},
+		{
+			name:    "truncated field",
+			message: "0a05",
+			wantErr: "truncated field",
+		},
+		{
+			name:    "field number 0",
+			message: "0001",
+			wantErr: "invalid field number 0",
+		},
+		{
+			name:    "group wire type",
+			message: "0b",
+			wantErr: "unsupported wire type 3",
+		},
+		{
+			name:    "timestamp out of range",
+			message: "0a16" + "0a027b7d" + "1210" + "0a0a08ffffffffffffffff7f" + "12026869",
+			wantErr: "out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := hex.DecodeString(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeProto(b)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeProto() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeProto() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeProto() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
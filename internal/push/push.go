@@ -0,0 +1,173 @@
+package push
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"log-pipeline/internal/httpauth"
+	"log-pipeline/internal/loki"
+	"log-pipeline/internal/metrics"
+)
+
+// Path is where Loki clients push entries.
+const Path = "/loki/api/v1/push"
+
+// maxDecodedSize bounds a push request once decompressed.
+const maxDecodedSize = 64 << 20
+
+// Target receives the pushed streams its selector matches.
+type Target struct {
+	Name     string
+	Selector loki.Selector
+	// Push returns once the streams have been written
+	Push func(streams []loki.Stream) error
+}
+
+// Handler implements Loki's JSON and protobuf push API.
+type Handler struct {
+	targets      []Target
+	maxBodyBytes int64
+	auth         *httpauth.Verifier
+}
+
+// NewHandler creates a handler for targets; a nil auth accepts any request.
+func NewHandler(targets []Target, maxBodyBytes int64, auth *httpauth.Verifier) *Handler {
+	return &Handler{targets: targets, maxBodyBytes: maxBodyBytes, auth: auth}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.auth != nil {
+		if err := h.auth.Verify(r); err != nil {
+			metrics.PushRequests.Inc("unauthorized")
+			status := http.StatusUnauthorized
+			if errors.Is(err, httpauth.ErrForbidden) {
+				status = http.StatusForbidden
+			} else if !errors.Is(err, httpauth.ErrUnauthorized) {
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	streams, err := h.decode(r)
+	if err != nil {
+		metrics.PushRequests.Inc("invalid")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, message := http.StatusNoContent, ""
+	matched := make([]bool, len(streams))
+	for _, t := range h.targets {
+		var selected []loki.Stream
+		for i, s := range streams {
+			if t.Selector.Matches(s.Stream) {
+				selected = append(selected, s)
+				matched[i] = true
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		if err := t.Push(selected); err != nil {
+			log.Printf("[%s] Failed to process pushed entries: %v", t.Name, err)
+			// Dedup drops the entries written before the client resends
+			status, message = http.StatusInternalServerError, err.Error()
+		}
+	}
+
+	unmatched := 0
+	for i, s := range streams {
+		if !matched[i] {
+			unmatched += len(s.Values)
+		}
+	}
+	metrics.PushUnmatched.Add(float64(unmatched))
+
+	if status == http.StatusNoContent {
+		metrics.PushRequests.Inc("success")
+		w.WriteHeader(status)
+		return
+	}
+	metrics.PushRequests.Inc("error")
+	http.Error(w, message, status)
+}
+
+// decode reads the streams of a JSON or snappy protobuf push request.
+func (h *Handler) decode(r *http.Request) ([]loki.Stream, error) {
+	var body io.Reader = http.MaxBytesReader(nil, r.Body, h.maxBodyBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %v", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxDecodedSize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %v", err)
+	}
+	if len(data) > maxDecodedSize {
+		return nil, fmt.Errorf("body exceeds %d bytes once decompressed", maxDecodedSize)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType == "application/json" {
+		return decodeJSON(data)
+	}
+
+	raw, err := decodeSnappy(data, maxDecodedSize)
+	if err != nil {
+		return nil, err
+	}
+	return decodeProto(raw)
+}
+
+// jsonPush is the JSON push body.
+type jsonPush struct {
+	Streams []struct {
+		Stream map[string]string   `json:"stream"`
+		Values [][]json.RawMessage `json:"values"`
+	} `json:"streams"`
+}
+
+func decodeJSON(data []byte) ([]loki.Stream, error) {
+	var req jsonPush
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %v", err)
+	}
+
+	streams := make([]loki.Stream, 0, len(req.Streams))
+	for _, s := range req.Streams {
+		stream := loki.Stream{Stream: s.Stream, Values: make([][]string, 0, len(s.Values))}
+		for _, v := range s.Values {
+			if len(v) < 2 {
+				return nil, fmt.Errorf("invalid JSON body: entry needs a timestamp and a line")
+			}
+			var ts, line string
+			if err := json.Unmarshal(v[0], &ts); err != nil {
+				return nil, fmt.Errorf("invalid JSON body: timestamp must be a string of Unix nanoseconds")
+			}
+			if err := json.Unmarshal(v[1], &line); err != nil {
+				return nil, fmt.Errorf("invalid JSON body: line must be a string")
+			}
+			stream.Values = append(stream.Values, []string{ts, line})
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
@@ -0,0 +1,109 @@
+package push
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// decodeSnappy decompresses an unframed snappy block of at most maxSize.
+func decodeSnappy(src []byte, maxSize int) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errors.New("snappy: invalid length")
+	}
+	if length > uint64(maxSize) {
+		return nil, fmt.Errorf("snappy: decoded size %d exceeds %d bytes", length, maxSize)
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case 0x00:
+			// Literal, with the length in the tag or after it
+			size := int(tag >> 2)
+			src = src[1:]
+			if size >= 60 {
+				extra := size - 59
+				if len(src) < extra {
+					return nil, errors.New("snappy: truncated literal length")
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			size++
+			if size <= 0 || size > len(src) {
+				return nil, errors.New("snappy: truncated literal")
+			}
+			if len(dst)+size > int(length) {
+				return nil, errors.New("snappy: literal overflows the decoded length")
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+
+		case 0x01:
+			// Copy with a 1-byte offset
+			if len(src) < 2 {
+				return nil, errors.New("snappy: truncated copy")
+			}
+			size := 4 + int(tag>>2&0x07)
+			offset := int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+			if err := snappyCopy(&dst, offset, size, int(length)); err != nil {
+				return nil, err
+			}
+
+		case 0x02:
+			// Copy with a 2-byte offset
+			if len(src) < 3 {
+				return nil, errors.New("snappy: truncated copy")
+			}
+			size := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			if err := snappyCopy(&dst, offset, size, int(length)); err != nil {
+				return nil, err
+			}
+
+		case 0x03:
+			// Copy with a 4-byte offset
+			if len(src) < 5 {
+				return nil, errors.New("snappy: truncated copy")
+			}
+			size := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+			if err := snappyCopy(&dst, offset, size, int(length)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(dst) != int(length) {
+		return nil, fmt.Errorf("snappy: decoded %d bytes, expected %d", len(dst), length)
+	}
+	return dst, nil
+}
+
+// snappyCopy appends size bytes starting offset bytes back.
+func snappyCopy(dst *[]byte, offset, size, length int) error {
+	d := *dst
+	if offset <= 0 || offset > len(d) {
+		return errors.New("snappy: invalid copy offset")
+	}
+	if len(d)+size > length {
+		return errors.New("snappy: copy overflows the decoded length")
+	}
+	start := len(d) - offset
+	for i := 0; i < size; i++ {
+		d = append(d, d[start+i])
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,119 @@
+package push
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSnappy(t *testing.T) {
+	// Encoded with github.com/golang/snappy, or built by hand per the format
+	// description and checked against it
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "short literal",
+			encoded: "051068656c6c6f",
+			want:    "hello",
+		},
+		{
+			name: "literal with a 1-byte length",
+			encoded: "51f05057696b697065646961206973206120667265652c207765622d62617365642c20636f6c6c61626f7261746976652c20" +
+				"6d756c74696c696e6775616c20656e6379636c6f70656469612070726f6a6563742e",
+			want: "Wikipedia is a free, web-based, collaborative, multilingual encyclopedia project.",
+		},
+		{
+			name: "copy with a 1-byte offset",
+			encoded: "2e60757365723d616c69636520616374696f6e3d6c6f67696e2075011840626f6220616374696f6e3d" +
+				"6c6f676f7574",
+			want: "user=alice action=login user=bob action=logout",
+		},
+		{
+			name:    "overlapping copy with a 2-byte offset",
+			encoded: "3c08616263e20300",
+			want:    strings.Repeat("abc", 20),
+		},
+		{
+			name: "copy with a 2-byte offset",
+			encoded: "5fc87b226c6576656c223a22696e666f222c226d7367223a226c6f67696e206f6b222c2275736572223a" +
+				"22616c696365227d207b229a310010626f62227d",
+			want: `{"level":"info","msg":"login ok","user":"alice"} {"level":"info","msg":"login ok","user":"bob"}`,
+		},
+		{
+			name:    "copy with a 4-byte offset",
+			encoded: "080c616263640f04000000",
+			want:    "abcdabcd",
+		},
+		{
+			name:    "overlapping copy with a 1-byte offset",
+			encoded: "0800610d01",
+			want:    "aaaaaaaa",
+		},
+		{
+			name:    "empty block",
+			encoded: "00",
+			want:    "",
+		},
+		{
+			name:    "invalid length",
+			encoded: "",
+			wantErr: "invalid length",
+		},
+		{
+			name:    "decoded size over the limit",
+			encoded: "ffff03",
+			wantErr: "exceeds",
+		},
+		{
+			name:    "truncated literal",
+			encoded: "051068656c",
+			wantErr: "truncated literal",
+		},
+		{
+			name:    "copy before any output",
+			encoded: "040d01",
+			wantErr: "invalid copy offset",
+		},
+		{
+			name:    "copy past the start",
+			encoded: "0800610d02",
+			wantErr: "invalid copy offset",
+		},
+		{
+			name:    "copy overflowing the length",
+			encoded: "0400610d01",
+			wantErr: "overflows",
+		},
+		{
+			name:    "short output",
+			encoded: "0a1068656c6c6f",
+			wantErr: "decoded 5 bytes, expected 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := hex.DecodeString(tt.encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeSnappy(src, 1024)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeSnappy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeSnappy() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decodeSnappy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package record
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Int converts a field value to an int64. Floats are truncated.
+func Int(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(String(v)), 10, 64)
+	return i, err == nil
+}
+
+// Float converts a field value to a float64.
+func Float(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(String(v)), 64)
+	return f, err == nil
+}
+
+// Bool converts a field value to a bool. Numbers are true when not zero.
+func Bool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(String(v)))
+	return b, err == nil
+}
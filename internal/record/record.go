@@ -0,0 +1,170 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Record is a log entry as it flows through the pipeline stages.
+type Record struct {
+	// Time is the event time, initially the Loki entry timestamp
+	Time time.Time
+	// Labels are the Loki stream labels
+	Labels map[string]string
+	// Fields are the parsed and transformed fields, in insertion order
+	Fields *Fields
+	// Raw is the original log line
+	Raw string
+}
+
+// New creates a record for a Loki entry with a copy of labels.
+func New(t time.Time, labels map[string]string, raw string) *Record {
+	copied := make(map[string]string, len(labels))
+	for name, value := range labels {
+		copied[name] = value
+	}
+	return &Record{
+		Time:   t,
+		Labels: copied,
+		Fields: NewFields(),
+		Raw:    raw,
+	}
+}
+
+// FromLoki creates a record from a Loki [timestamp, line] pair.
+func FromLoki(value []string, labels map[string]string) (*Record, error) {
+	if len(value) < 2 {
+		return nil, fmt.Errorf("malformed Loki entry: %v", value)
+	}
+	nanos, err := strconv.ParseInt(value[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Loki timestamp %q: %v", value[0], err)
+	}
+	return New(time.Unix(0, nanos).UTC(), labels, value[1]), nil
+}
+
+// Fields is an ordered map of field names to typed values.
+type Fields struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func NewFields() *Fields {
+	return &Fields{values: make(map[string]interface{})}
+}
+
+func (f *Fields) Get(key string) (interface{}, bool) {
+	v, ok := f.values[key]
+	return v, ok
+}
+
+// GetString returns the field formatted as a string.
+func (f *Fields) GetString(key string) (string, bool) {
+	v, ok := f.values[key]
+	if !ok {
+		return "", false
+	}
+	return String(v), true
+}
+
+// Set adds or replaces a field, keeping its position.
+func (f *Fields) Set(key string, value interface{}) {
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = value
+}
+
+func (f *Fields) Delete(key string) {
+	if _, ok := f.values[key]; !ok {
+		return
+	}
+	delete(f.values, key)
+	for i, k := range f.keys {
+		if k == key {
+			f.keys = append(f.keys[:i], f.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Rename moves a field to a new name in place.
+func (f *Fields) Rename(from, to string) bool {
+	v, ok := f.values[from]
+	if !ok || from == to {
+		return ok
+	}
+	f.Delete(to)
+	for i, k := range f.keys {
+		if k == from {
+			f.keys[i] = to
+			break
+		}
+	}
+	delete(f.values, from)
+	f.values[to] = v
+	return true
+}
+
+func (f *Fields) Len() int {
+	return len(f.keys)
+}
+
+// Keys returns the field names in order.
+func (f *Fields) Keys() []string {
+	return append([]string(nil), f.keys...)
+}
+
+// Range calls fn for every field in order until fn returns false.
+func (f *Fields) Range(fn func(key string, value interface{}) bool) {
+	for _, k := range f.keys {
+		if !fn(k, f.values[k]) {
+			return
+		}
+	}
+}
+
+// MarshalJSON encodes the fields as a JSON object in field order.
+func (f *Fields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range f.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.values[k])
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", k, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// String formats a field value for use as text.
+func String(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,57 @@
+package redact
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+var builtins = map[string]*detector{
+	"email": {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	// Contiguous digits, or groups of four as printed (four-six-five for Amex)
+	"credit_card": {
+		re:    regexp.MustCompile(`\b(?:\d{13,19}|\d{4}[ \-]\d{4,6}[ \-]\d{4,5}(?:[ \-]\d{1,4})?)\b`),
+		valid: luhn,
+	},
+	"ipv4": {
+		re:    regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		valid: func(s string) bool { return net.ParseIP(s) != nil },
+	},
+	// Bounded by non-word characters so "SCHEMA::dbo" is not an address
+	"ipv6": {
+		re:        regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}`),
+		valid:     func(s string) bool { return strings.Contains(s, ":") && net.ParseIP(s) != nil },
+		notBefore: wordChars + ":.",
+		notAfter:  wordChars + ":",
+	},
+	// SQL Server CREATE/ALTER LOGIN and similar statements
+	"password": {
+		re:    regexp.MustCompile(`(?i)\bPASSWORD\s*=\s*N?'((?:[^']|'')*)'`),
+		group: 1,
+	},
+}
+
+const wordChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_"
+
+// luhn reports whether the digits of s pass the Luhn check.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
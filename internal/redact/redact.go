@@ -0,0 +1,164 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Action is what happens to a detected value.
+type Action string
+
+const (
+	// Mask replaces the value with a fixed mask
+	Mask Action = "mask"
+	// Drop removes the value, keeping the text around it
+	Drop Action = "drop"
+	// HMAC replaces the value with its keyed hash
+	HMAC Action = "hmac"
+)
+
+// DefaultMask replaces masked values.
+const DefaultMask = "[REDACTED]"
+
+// Options configures a Redactor.
+type Options struct {
+	// Detectors names the built-in detectors to run
+	Detectors []string
+	// Patterns are extra regular expressions; only a first group is redacted
+	Patterns []string
+	// Action is "mask" (default), "drop" or "hmac"
+	Action Action
+	// Mask replaces values for the "mask" action (default DefaultMask)
+	Mask string
+	// Key is the HMAC key, required for the "hmac" action
+	Key []byte
+}
+
+// Redactor finds sensitive values in text.
+type Redactor struct {
+	detectors []*detector
+	action    Action
+	mask      string
+	key       []byte
+}
+
+func New(opts Options) (*Redactor, error) {
+	r := &Redactor{action: opts.Action, mask: opts.Mask, key: opts.Key}
+	if r.action == "" {
+		r.action = Mask
+	}
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+
+	switch r.action {
+	case Mask, Drop:
+	case HMAC:
+		if len(r.key) == 0 {
+			return nil, fmt.Errorf("hmac redaction requires a key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown redaction action %q", r.action)
+	}
+
+	for _, name := range opts.Detectors {
+		d, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	for _, pattern := range opts.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern: %v", err)
+		}
+		r.detectors = append(r.detectors, &detector{re: re, group: min(re.NumSubexp(), 1)})
+	}
+	if len(r.detectors) == 0 {
+		return nil, fmt.Errorf("redaction requires detectors or patterns")
+	}
+
+	return r, nil
+}
+
+// Redact returns s with every detected value redacted, and whether any was.
+func (r *Redactor) Redact(s string) (redacted string, found bool) {
+	var spans [][2]int
+	for _, d := range r.detectors {
+		spans = append(spans, d.find(s)...)
+	}
+	if len(spans) == 0 {
+		return s, false
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span[0] < last {
+			// Overlaps a value already replaced
+			if span[1] <= last {
+				continue
+			}
+			span[0] = last
+		}
+		b.WriteString(s[last:span[0]])
+		b.WriteString(r.replace(s[span[0]:span[1]]))
+		last = span[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func (r *Redactor) replace(value string) string {
+	switch r.action {
+	case Drop:
+		return ""
+	case Mask:
+		return r.mask
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// detector finds values with a regular expression, optionally confirmed by valid.
+type detector struct {
+	re    *regexp.Regexp
+	group int
+	valid func(string) bool
+	// notBefore and notAfter reject matches next to these characters
+	notBefore string
+	notAfter  string
+}
+
+func (d *detector) find(s string) [][2]int {
+	var spans [][2]int
+	for _, m := range d.re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[2*d.group], m[2*d.group+1]
+		if start < 0 || start == end {
+			continue
+		}
+		if d.valid != nil && !d.valid(s[start:end]) {
+			continue
+		}
+		if start > 0 && strings.IndexByte(d.notBefore, s[start-1]) >= 0 || end < len(s) && strings.IndexByte(d.notAfter, s[end]) >= 0 {
+			continue
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+	return spans
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
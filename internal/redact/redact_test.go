@@ -0,0 +1,154 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		detector string
+		input    string
+		want     string
+	}{
+		{"email", "email", "login by jane.doe+audit@example.co.uk failed", "login by [REDACTED] failed"},
+		{"no email", "email", "user@localhost", "user@localhost"},
+		{"card number", "credit_card", "card 4111111111111111 charged", "card [REDACTED] charged"},
+		{"grouped card number", "credit_card", "card 4111-1111-1111-1111.", "card [REDACTED]."},
+		{"Amex grouping", "credit_card", "amex 3782 822463 10005", "amex [REDACTED]"},
+		{"failed Luhn check", "credit_card", "order 4111111111111112", "order 4111111111111112"},
+		{"too short for a card", "credit_card", "id 123456789012", "id 123456789012"},
+		{"ipv4", "ipv4", "from 10.0.0.12:1433", "from [REDACTED]:1433"},
+		{"not an ipv4 address", "ipv4", "version 10.0.999.1", "version 10.0.999.1"},
+		{"ipv6", "ipv6", "client fe80::1ff:fe23:4567:890a connected", "client [REDACTED] connected"},
+		{"consecutive ipv6", "ipv6", "fe80::1 fe80::2,::1", "[REDACTED] [REDACTED],[REDACTED]"},
+		{"ipv6 at the end of a sentence", "ipv6", "from 2001:db8::8a2e:370:7334.", "from [REDACTED]."},
+		{"scope qualifier is not ipv6", "ipv6", "GRANT SELECT ON SCHEMA::dbo TO app", "GRANT SELECT ON SCHEMA::dbo TO app"},
+		{"time is not ipv6", "ipv6", "at 10:30:00", "at 10:30:00"},
+		{"password", "password", "ALTER LOGIN sa WITH PASSWORD = N'it''s secret' MUST_CHANGE", "ALTER LOGIN sa WITH PASSWORD = N'[REDACTED]' MUST_CHANGE"},
+		{"password without spaces", "password", "CREATE LOGIN app WITH password='x1'", "CREATE LOGIN app WITH password='[REDACTED]'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(Options{Detectors: []string{tt.detector}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, found := r.Redact(tt.input)
+			if got != tt.want || found != (tt.want != tt.input) {
+				t.Errorf("Redact(%q) = %q, %v, want %q", tt.input, got, found, tt.want)
+			}
+		})
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		input string
+		want  string
+	}{
+		{
+			name:  "custom mask",
+			opts:  Options{Detectors: []string{"email"}, Mask: "***"},
+			input: "to a@example.com and b@example.com",
+			want:  "to *** and ***",
+		},
+		{
+			name:  "drop removes only the value",
+			opts:  Options{Detectors: []string{"email"}, Action: Drop},
+			input: "sent to a@example.com by job 7",
+			want:  "sent to  by job 7",
+		},
+		{
+			name:  "hmac",
+			opts:  Options{Detectors: []string{"email"}, Action: HMAC, Key: []byte("k")},
+			input: "a@example.com",
+			want:  "hmac:",
+		},
+		{
+			name:  "capture group of a pattern",
+			opts:  Options{Patterns: []string{`token=(\w+)`}},
+			input: "GET /?token=abc123&x=1",
+			want:  "GET /?token=[REDACTED]&x=1",
+		},
+		{
+			name:  "overlapping matches",
+			opts:  Options{Detectors: []string{"email"}, Patterns: []string{`example\.com and \w+`}},
+			input: "a@example.com and more",
+			want:  "[REDACTED][REDACTED]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, found := r.Redact(tt.input)
+			if !found || !strings.HasPrefix(got, tt.want) || tt.opts.Action != HMAC && got != tt.want {
+				t.Errorf("Redact(%q) = %q, %v, want %q", tt.input, got, found, tt.want)
+			}
+		})
+	}
+}
+
+func TestHMACIsStable(t *testing.T) {
+	r, err := New(Options{Detectors: []string{"email"}, Action: HMAC, Key: []byte("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := r.Redact("a@example.com")
+	b, _ := r.Redact("a@example.com")
+	c, _ := r.Redact("c@example.com")
+	if a != b || a == c || strings.Contains(a, "example") {
+		t.Errorf("Redact() = %q, %q, %q; want equal values to hash equally", a, b, c)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"no detectors", Options{}, "requires detectors or patterns"},
+		{"unknown detector", Options{Detectors: []string{"ssn"}}, "unknown redaction detector"},
+		{"unknown action", Options{Detectors: []string{"email"}, Action: "erase"}, "unknown redaction action"},
+		{"hmac without a key", Options{Detectors: []string{"email"}, Action: HMAC}, "requires a key"},
+		{"invalid pattern", Options{Patterns: []string{"("}}, "invalid redaction pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("New() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"5500-0000-0000-0004", true},
+		{"378282246310005", true},
+		{"4111111111111112", false},
+		{"411111111111", false},
+		{"41111111111111111111", false},
+	}
+
+	for _, tt := range tests {
+		if got := luhn(tt.number); got != tt.want {
+			t.Errorf("luhn(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/sony/gobreaker"
+	"log-pipeline/internal/metrics"
 )
 
 // CircuitBreaker is an alias for gobreaker.CircuitBreaker to make it part of our package
@@ -33,12 +34,14 @@ func NewCircuitBreaker(name string) *CircuitBreaker {
 		},
 		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
 			fmt.Printf("Circuit breaker %s state changed from %s to %s\n", name, from, to)
+			metrics.CircuitBreakerState.Set(float64(to), name)
 		},
 	})
 }
 
 // NewCircuitBreakerWithConfig creates a new circuit breaker with custom configuration
 func NewCircuitBreakerWithConfig(config CircuitBreakerConfig) *CircuitBreaker {
+	metrics.CircuitBreakerState.Set(float64(gobreaker.StateClosed), config.Name)
 	return gobreaker.NewCircuitBreaker(gobreaker.Settings{
 		Name:          config.Name,
 		MaxRequests:   config.MaxRequests,
@@ -47,4 +50,4 @@ func NewCircuitBreakerWithConfig(config CircuitBreakerConfig) *CircuitBreaker {
 		ReadyToTrip:   config.ReadyToTrip,
 		OnStateChange: config.OnStateChange,
 	})
-}
\ No newline at end of file
+}
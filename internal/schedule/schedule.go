@@ -0,0 +1,41 @@
+package schedule
+
+import "time"
+
+// Scheduler computes the contiguous windows a polling pipeline processes.
+type Scheduler struct {
+	// Lookback is how far back the first window reaches
+	Lookback time.Duration
+	// Delay holds the end of every window back from now
+	Delay time.Duration
+	// MaxWindow bounds the length of a window; zero means unbounded
+	MaxWindow time.Duration
+}
+
+// Window is a [Start, End) range to process.
+type Window struct {
+	Start time.Time
+	End   time.Time
+	// Backlog is how far End trails the latest time that may be processed
+	Backlog time.Duration
+}
+
+// Empty reports whether there is nothing to process yet.
+func (w Window) Empty() bool {
+	return !w.End.After(w.Start)
+}
+
+// Next returns the window following watermark at time now.
+func (s Scheduler) Next(watermark, now time.Time) Window {
+	// Window bounds are persisted, so drop the monotonic clock reading
+	latest := now.Round(0).Add(-s.Delay)
+	w := Window{Start: watermark, End: latest}
+	if watermark.IsZero() {
+		w.Start = latest.Add(-s.Lookback)
+	}
+	if s.MaxWindow > 0 && w.End.Sub(w.Start) > s.MaxWindow {
+		w.End = w.Start.Add(s.MaxWindow)
+		w.Backlog = latest.Sub(w.End)
+	}
+	return w
+}
@@ -0,0 +1,92 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerNext(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		scheduler Scheduler
+		watermark time.Time
+		want      Window
+	}{
+		{
+			name:      "first window looks back",
+			scheduler: Scheduler{Lookback: 5 * time.Minute},
+			want:      Window{Start: now.Add(-5 * time.Minute), End: now},
+		},
+		{
+			name:      "first window is held back by the delay",
+			scheduler: Scheduler{Lookback: 5 * time.Minute, Delay: 30 * time.Second},
+			want:      Window{Start: now.Add(-5*time.Minute - 30*time.Second), End: now.Add(-30 * time.Second)},
+		},
+		{
+			name:      "window starts at the watermark",
+			scheduler: Scheduler{Lookback: 5 * time.Minute, MaxWindow: 5 * time.Minute},
+			watermark: now.Add(-time.Minute),
+			want:      Window{Start: now.Add(-time.Minute), End: now},
+		},
+		{
+			name:      "gap since the watermark is covered whole",
+			scheduler: Scheduler{Lookback: 5 * time.Minute},
+			watermark: now.Add(-3 * time.Hour),
+			want:      Window{Start: now.Add(-3 * time.Hour), End: now},
+		},
+		{
+			name:      "catch-up is bounded by the max window",
+			scheduler: Scheduler{Lookback: 5 * time.Minute, MaxWindow: 10 * time.Minute},
+			watermark: now.Add(-time.Hour),
+			want: Window{
+				Start:   now.Add(-time.Hour),
+				End:     now.Add(-50 * time.Minute),
+				Backlog: 50 * time.Minute,
+			},
+		},
+		{
+			name:      "backlog is measured from the delayed end",
+			scheduler: Scheduler{Lookback: 5 * time.Minute, Delay: time.Minute, MaxWindow: 10 * time.Minute},
+			watermark: now.Add(-time.Hour),
+			want: Window{
+				Start:   now.Add(-time.Hour),
+				End:     now.Add(-50 * time.Minute),
+				Backlog: 49 * time.Minute,
+			},
+		},
+		{
+			name:      "last catch-up window has no backlog",
+			scheduler: Scheduler{Lookback: 5 * time.Minute, Delay: time.Minute, MaxWindow: 10 * time.Minute},
+			watermark: now.Add(-11 * time.Minute),
+			want:      Window{Start: now.Add(-11 * time.Minute), End: now.Add(-time.Minute)},
+		},
+		{
+			name:      "watermark ahead of the delayed end is empty",
+			scheduler: Scheduler{Lookback: 5 * time.Minute, Delay: time.Minute},
+			watermark: now.Add(-30 * time.Second),
+			want:      Window{Start: now.Add(-30 * time.Second), End: now.Add(-time.Minute)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.scheduler.Next(tt.watermark, now)
+			if !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) || got.Backlog != tt.want.Backlog {
+				t.Errorf("Next() = %v to %v, backlog %v; want %v to %v, backlog %v",
+					got.Start, got.End, got.Backlog, tt.want.Start, tt.want.End, tt.want.Backlog)
+			}
+			if got.Empty() != !tt.want.End.After(tt.want.Start) {
+				t.Errorf("Empty() = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestSchedulerNextDropsMonotonicClock(t *testing.T) {
+	w := Scheduler{Lookback: time.Minute}.Next(time.Time{}, time.Now())
+	if w.End != w.End.Round(0) || w.Start != w.Start.Round(0) {
+		t.Errorf("window bounds carry a monotonic clock reading: %v to %v", w.Start, w.End)
+	}
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Change is a difference between two versions of a schema.
+type Change struct {
+	Field  string
+	Detail string
+	// Breaking is set when queries against the old version stop matching
+	Breaking bool
+}
+
+func (c Change) String() string {
+	kind := "compatible"
+	if c.Breaking {
+		kind = "BREAKING"
+	}
+	return fmt.Sprintf("%-10s  %s: %s", kind, c.Field, c.Detail)
+}
+
+// Diff reports how records of version from differ from those of version to.
+func Diff(from, to *Schema) []Change {
+	renamed := make(map[string]string)
+	split := make(map[string][]string)
+	defaults := make(map[string]bool)
+	dropped := make(map[string]bool)
+	for _, m := range migrationsBetween(from, to) {
+		// Follow fields renamed more than once back to their original name
+		origin := m.Field
+		for old, current := range renamed {
+			if current == m.Field {
+				origin = old
+			}
+		}
+		switch m.Op {
+		case "rename":
+			renamed[origin] = m.To
+		case "split":
+			delete(renamed, origin)
+			split[origin] = m.Into
+		case "default":
+			defaults[m.Field] = true
+		case "drop":
+			dropped[origin] = true
+		}
+	}
+
+	var changes []Change
+	carried := make(map[string]bool)
+	for _, old := range from.Fields {
+		name := old.Name
+		if into, ok := split[name]; ok {
+			changes = append(changes, Change{name, "split into " + strings.Join(into, ", "), true})
+			for _, f := range into {
+				carried[f] = true
+			}
+			continue
+		}
+		if dropped[name] {
+			changes = append(changes, Change{name, "dropped", true})
+			continue
+		}
+		if to, ok := renamed[name]; ok {
+			changes = append(changes, Change{name, "renamed to " + to, true})
+			name = to
+		}
+
+		f, ok := to.Field(name)
+		if !ok {
+			if to.UnknownFields == KeepUnknown {
+				changes = append(changes, Change{name, "no longer declared, shipped unchecked", false})
+			} else {
+				changes = append(changes, Change{name, "removed", true})
+			}
+			continue
+		}
+		carried[name] = true
+		if f.Type != old.Type {
+			changes = append(changes, Change{name, fmt.Sprintf("type changed from %s to %s", old.Type, f.Type), true})
+		}
+		if old.Required && !f.Required {
+			changes = append(changes, Change{name, "no longer required, may be missing", false})
+		}
+		if !old.Required && f.Required {
+			changes = append(changes, Change{name, "now required", false})
+		}
+	}
+
+	for _, f := range to.Fields {
+		if carried[f.Name] {
+			continue
+		}
+		detail := "added as " + f.Type
+		if defaults[f.Name] {
+			detail += ", defaulted in older records"
+		}
+		changes = append(changes, Change{f.Name, detail, false})
+	}
+
+	if from.UnknownFields == KeepUnknown && to.UnknownFields != KeepUnknown {
+		policy := map[string]string{DropUnknown: "dropped", RejectUnknown: "rejected"}[to.UnknownFields]
+		changes = append(changes, Change{"*", "undeclared fields are now " + policy, true})
+	}
+	return changes
+}
+
+// migrationsBetween returns the migrations from version from to to, oldest first.
+func migrationsBetween(from, to *Schema) []Migration {
+	var versions []*Schema
+	for s := to; s != nil && s.Version > from.Version; s = s.previous {
+		versions = append(versions, s)
+	}
+	var migrations []Migration
+	for i := len(versions) - 1; i >= 0; i-- {
+		migrations = append(migrations, versions[i].Migrations...)
+	}
+	return migrations
+}
@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"log-pipeline/internal/record"
+)
+
+// maxDistinct bounds the distinct values counted per field.
+const maxDistinct = 10000
+
+// Inferrer derives a schema from sample records.
+type Inferrer struct {
+	records int
+	order   []string
+	fields  map[string]*fieldStats
+}
+
+// FieldStats summarizes the sampled values of one field.
+type FieldStats struct {
+	Name string
+	// Type is the narrowest schema type every value converts to
+	Type string
+	// Present is the number of records holding a non-empty value
+	Present int
+	// Distinct is the number of distinct values, at most maxDistinct
+	Distinct int
+}
+
+type fieldStats struct {
+	present int
+	types   map[string]int
+	values  map[string]struct{}
+}
+
+func NewInferrer() *Inferrer {
+	return &Inferrer{fields: make(map[string]*fieldStats)}
+}
+
+// Observe adds a sample record.
+func (i *Inferrer) Observe(rec *record.Record) {
+	i.records++
+	rec.Fields.Range(func(key string, value interface{}) bool {
+		if key == VersionField {
+			return true
+		}
+		f, ok := i.fields[key]
+		if !ok {
+			f = &fieldStats{types: make(map[string]int), values: make(map[string]struct{})}
+			i.fields[key] = f
+			i.order = append(i.order, key)
+		}
+		if value == nil || value == "" {
+			return true
+		}
+		f.present++
+		f.types[valueType(value)]++
+		if len(f.values) < maxDistinct {
+			f.values[record.String(value)] = struct{}{}
+		}
+		return true
+	})
+}
+
+// Records returns the number of records observed.
+func (i *Inferrer) Records() int {
+	return i.records
+}
+
+// Stats returns the summary of every field, in order of first appearance.
+func (i *Inferrer) Stats() []FieldStats {
+	stats := make([]FieldStats, 0, len(i.order))
+	for _, name := range i.order {
+		f := i.fields[name]
+		stats = append(stats, FieldStats{
+			Name:     name,
+			Type:     f.inferType(),
+			Present:  f.present,
+			Distinct: len(f.values),
+		})
+	}
+	return stats
+}
+
+// Schema returns a schema declaring every observed field.
+func (i *Inferrer) Schema(name string) *Schema {
+	s := &Schema{Name: name, Version: 1}
+	for _, f := range i.Stats() {
+		s.Fields = append(s.Fields, Field{
+			Name:     f.Name,
+			Type:     f.Type,
+			Required: i.records > 0 && f.Present == i.records,
+		})
+	}
+	return s
+}
+
+// StreamFields suggests the low-cardinality string fields of every record.
+func (i *Inferrer) StreamFields(maxCardinality int) []string {
+	var candidates []FieldStats
+	for _, f := range i.Stats() {
+		if f.Type == "string" && f.Present == i.records && f.Distinct <= maxCardinality && f.Distinct*10 <= i.records {
+			candidates = append(candidates, f)
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Distinct < candidates[b].Distinct
+	})
+
+	var fields []string
+	for _, f := range candidates {
+		fields = append(fields, f.Name)
+	}
+	return fields
+}
+
+// valueType classifies a value by the narrowest schema type it converts to.
+func valueType(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return "int64"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "timestamp"
+	case string:
+		s := strings.TrimSpace(v)
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return "int64"
+		}
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return "float"
+		}
+		if _, err := strconv.ParseBool(s); err == nil {
+			return "bool"
+		}
+		if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return "timestamp"
+		}
+	}
+	return "string"
+}
+
+// inferType picks the type all values of a field convert to.
+func (f *fieldStats) inferType() string {
+	switch {
+	case len(f.types) == 0:
+		return "string"
+	case len(f.types) == 1:
+		for t := range f.types {
+			return t
+		}
+	case len(f.types) == 2 && f.types["int64"] > 0 && f.types["float"] > 0:
+		return "float"
+	}
+	return "string"
+}
@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"log-pipeline/internal/record"
+)
+
+// Migration is one rule upgrading records from the previous schema version.
+type Migration struct {
+	Op        string      `json:"op"`
+	Field     string      `json:"field"`
+	To        string      `json:"to"`
+	Into      []string    `json:"into"`
+	Separator string      `json:"separator"`
+	Value     interface{} `json:"value"`
+}
+
+func (m *Migration) check() error {
+	if m.Field == "" {
+		return fmt.Errorf("%s migration requires field", m.Op)
+	}
+	switch m.Op {
+	case "rename":
+		if m.To == "" {
+			return fmt.Errorf("rename migration of %q requires to", m.Field)
+		}
+	case "split":
+		if len(m.Into) < 2 || m.Separator == "" {
+			return fmt.Errorf("split migration of %q requires into and separator", m.Field)
+		}
+	case "default", "drop":
+	default:
+		return fmt.Errorf("unknown migration op %q", m.Op)
+	}
+	return nil
+}
+
+func (m *Migration) Apply(rec *record.Record) {
+	switch m.Op {
+	case "rename":
+		rec.Fields.Rename(m.Field, m.To)
+	case "split":
+		value, ok := rec.Fields.GetString(m.Field)
+		if !ok {
+			return
+		}
+		parts := strings.SplitN(value, m.Separator, len(m.Into))
+		// Fill from the right, so a lone "user" is the user
+		offset := len(m.Into) - len(parts)
+		for i, into := range m.Into {
+			if i < offset {
+				rec.Fields.Set(into, "")
+			} else {
+				rec.Fields.Set(into, parts[i-offset])
+			}
+		}
+		rec.Fields.Delete(m.Field)
+	case "default":
+		if value, ok := rec.Fields.Get(m.Field); !ok || value == nil {
+			rec.Fields.Set(m.Field, m.Value)
+		}
+	case "drop":
+		rec.Fields.Delete(m.Field)
+	}
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Registry holds schemas by name and version.
+type Registry struct {
+	mutex   sync.RWMutex
+	schemas map[string]map[int]*Schema
+}
+
+// NewRegistry creates a registry holding the built-in schemas.
+func NewRegistry() *Registry {
+	r := &Registry{schemas: make(map[string]map[int]*Schema)}
+	builtin, err := Parse([]byte(DatabaseAuditLogs))
+	if err != nil {
+		panic(err)
+	}
+	r.Register(builtin)
+	return r
+}
+
+// Register adds a schema, replacing any schema of the same name and version.
+func (r *Registry) Register(s *Schema) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	versions := r.schemas[s.Name]
+	if versions == nil {
+		versions = make(map[int]*Schema)
+		r.schemas[s.Name] = versions
+	}
+	versions[s.Version] = s
+
+	// Link every version to the one before it for upgrades
+	var prev *Schema
+	for _, v := range sortedVersions(versions) {
+		versions[v].previous = prev
+		prev = versions[v]
+	}
+}
+
+// LoadFile registers the schema stored in a file.
+func (r *Registry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	r.Register(s)
+	return nil
+}
+
+// Get returns version of the schema called name, or the latest for 0.
+func (r *Registry) Get(name string, version int) (*Schema, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	versions, ok := r.schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q", name)
+	}
+	if version == 0 {
+		all := sortedVersions(versions)
+		version = all[len(all)-1]
+	}
+	s, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("schema %q has no version %d", name, version)
+	}
+	return s, nil
+}
+
+// Versions returns the registered versions of name in ascending order.
+func (r *Registry) Versions(name string) []int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return sortedVersions(r.schemas[name])
+}
+
+func sortedVersions(versions map[int]*Schema) []int {
+	var sorted []int
+	for v := range versions {
+		sorted = append(sorted, v)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
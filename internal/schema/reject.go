@@ -0,0 +1,63 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"log-pipeline/internal/record"
+)
+
+// Rejection is a rejected record as written to a RejectFile, without the raw line.
+type Rejection struct {
+	Time     time.Time         `json:"time"`
+	Pipeline string            `json:"pipeline"`
+	Reason   string            `json:"reason"`
+	Labels   map[string]string `json:"labels"`
+	Fields   *record.Fields    `json:"fields"`
+}
+
+// RejectFile appends rejected records to an owner-only file as JSON lines.
+type RejectFile struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewRejectFile(path string) (*RejectFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reject file: %v", err)
+	}
+	return &RejectFile{file: file}, nil
+}
+
+// Write records why rec was rejected by pipeline.
+func (f *RejectFile) Write(pipeline string, rec *record.Record, reason error) error {
+	line, err := json.Marshal(Rejection{
+		Time:     rec.Time,
+		Pipeline: pipeline,
+		Reason:   reason.Error(),
+		Labels:   rec.Labels,
+		Fields:   rec.Fields,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal rejected record: %v", err)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write rejected record: %v", err)
+	}
+	return nil
+}
+
+func (f *RejectFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.file.Close()
+}
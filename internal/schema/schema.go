@@ -1,6 +1,16 @@
 package schema
 
-const Schema = `
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"log-pipeline/internal/record"
+	"log-pipeline/pkg/utils"
+)
+
+// DatabaseAuditLogs is the built-in schema of the SQL Server audit records.
+const DatabaseAuditLogs = `
 {
     "name": "database_audit_logs",
     "version": 1,
@@ -24,3 +34,199 @@ const Schema = `
     ]
 }
 `
+
+// VersionField holds the schema version of a record.
+const VersionField = "schema_version"
+
+// Unknown field policies.
+const (
+	// KeepUnknown ships fields the schema does not declare
+	KeepUnknown = "keep"
+	// DropUnknown removes fields the schema does not declare
+	DropUnknown = "drop"
+	// RejectUnknown rejects records with fields the schema does not declare
+	RejectUnknown = "reject"
+)
+
+// Schema declares the fields of the records shipped to Victoria.
+type Schema struct {
+	Name    string  `json:"name"`
+	Version int     `json:"version"`
+	Fields  []Field `json:"fields"`
+	// UnknownFields is "keep" (default), "drop" or "reject"
+	UnknownFields string `json:"unknownFields,omitempty"`
+	// Migrations upgrade records of the previous version to this one
+	Migrations []Migration `json:"migrations,omitempty"`
+
+	byName map[string]*Field
+	// previous is the registered version before this one, if any
+	previous *Schema
+}
+
+// Field declares one field.
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// Parse reads and checks a schema document.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) init() error {
+	if s.Name == "" {
+		return fmt.Errorf("schema has no name")
+	}
+	if s.Version <= 0 {
+		return fmt.Errorf("schema %s has no version", s.Name)
+	}
+	switch s.UnknownFields {
+	case "":
+		s.UnknownFields = KeepUnknown
+	case KeepUnknown, DropUnknown, RejectUnknown:
+	default:
+		return fmt.Errorf("schema %s: unknown unknownFields policy %q", s.Name, s.UnknownFields)
+	}
+
+	s.byName = make(map[string]*Field, len(s.Fields))
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if _, ok := coercions[f.Type]; !ok {
+			return fmt.Errorf("schema %s: field %q has unknown type %q", s.Name, f.Name, f.Type)
+		}
+		if s.byName[f.Name] != nil {
+			return fmt.Errorf("schema %s: field %q is declared more than once", s.Name, f.Name)
+		}
+		s.byName[f.Name] = f
+	}
+	for i := range s.Migrations {
+		if err := s.Migrations[i].check(); err != nil {
+			return fmt.Errorf("schema %s version %d: %v", s.Name, s.Version, err)
+		}
+	}
+	return nil
+}
+
+// Field returns the declaration of a field.
+func (s *Schema) Field(name string) (*Field, bool) {
+	f, ok := s.byName[name]
+	return f, ok
+}
+
+// ValidationError explains why a record does not match its schema.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("field %s: %s", e.Field, e.Reason)
+}
+
+// Validate checks a record against the schema, converting fields in place.
+func (s *Schema) Validate(rec *record.Record) error {
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		value, ok := rec.Fields.Get(f.Name)
+		if !ok || value == nil {
+			if f.Required {
+				return &ValidationError{Field: f.Name, Reason: "required field is missing"}
+			}
+			continue
+		}
+		coerced, ok := coercions[f.Type](value)
+		if !ok {
+			return &ValidationError{Field: f.Name, Reason: fmt.Sprintf("cannot convert %q to %s", record.String(value), f.Type)}
+		}
+		rec.Fields.Set(f.Name, coerced)
+	}
+
+	if s.UnknownFields == KeepUnknown {
+		return nil
+	}
+	for _, key := range rec.Fields.Keys() {
+		if _, declared := s.byName[key]; declared || key == VersionField {
+			continue
+		}
+		if s.UnknownFields == RejectUnknown {
+			return &ValidationError{Field: key, Reason: "field is not declared"}
+		}
+		rec.Fields.Delete(key)
+	}
+	return nil
+}
+
+// Upgrade migrates a record to this version; an unstamped one is taken to be in it.
+func (s *Schema) Upgrade(rec *record.Record) error {
+	chain := []*Schema{s}
+	for prev := s.previous; prev != nil; prev = prev.previous {
+		chain = append(chain, prev)
+	}
+	from := s.Version
+	if value, ok := rec.Fields.Get(VersionField); ok {
+		v, ok := record.Int(value)
+		if !ok {
+			return &ValidationError{Field: VersionField, Reason: fmt.Sprintf("invalid version %q", record.String(value))}
+		}
+		if v > int64(s.Version) {
+			return &ValidationError{Field: VersionField, Reason: fmt.Sprintf("version %d is newer than %d", v, s.Version)}
+		}
+		from = int(v)
+	}
+
+	// Apply the migrations of every newer version, oldest first
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].Version <= from {
+			continue
+		}
+		for j := range chain[i].Migrations {
+			chain[i].Migrations[j].Apply(rec)
+		}
+	}
+	rec.Fields.Set(VersionField, int64(s.Version))
+	return nil
+}
+
+var coercions = map[string]func(interface{}) (interface{}, bool){
+	"string": func(v interface{}) (interface{}, bool) {
+		return record.String(v), true
+	},
+	"int":   toInt,
+	"int64": toInt,
+	"float": func(v interface{}) (interface{}, bool) {
+		return record.Float(v)
+	},
+	"bool": func(v interface{}) (interface{}, bool) {
+		return record.Bool(v)
+	},
+	"timestamp": toTimestamp,
+}
+
+func toInt(v interface{}) (interface{}, bool) {
+	return record.Int(v)
+}
+
+func toTimestamp(v interface{}) (interface{}, bool) {
+	var t time.Time
+	var err error
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		t, err = utils.EpochTime(v, "")
+	case float64:
+		t, err = utils.EpochTimeFloat(v, "")
+	default:
+		t, err = utils.ParseTime(record.String(v), []string{time.RFC3339Nano}, time.UTC)
+	}
+	return t, err == nil
+}
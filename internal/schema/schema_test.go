@@ -0,0 +1,189 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"log-pipeline/internal/record"
+)
+
+func newRecord(fields ...interface{}) *record.Record {
+	rec := record.New(time.Unix(0, 0), nil, "")
+	for i := 0; i < len(fields); i += 2 {
+		rec.Fields.Set(fields[i].(string), fields[i+1])
+	}
+	return rec
+}
+
+func mustParse(t *testing.T, doc string) *Schema {
+	t.Helper()
+	s, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	const fields = `"fields": [
+		{"name": "id", "type": "int64", "required": true},
+		{"name": "at", "type": "timestamp"},
+		{"name": "ok", "type": "bool"},
+		{"name": "name", "type": "string"}
+	]`
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		unknown string
+		rec     *record.Record
+		want    *record.Record
+		wantErr string
+	}{
+		{
+			name: "values are converted to their types",
+			rec:  newRecord("id", "42", "at", "2024-05-01T12:00:00Z", "ok", "true", "name", int64(7)),
+			want: newRecord("id", int64(42), "at", at, "ok", true, "name", "7"),
+		},
+		{
+			name: "epoch timestamps",
+			rec:  newRecord("id", int64(1), "at", at.Unix()),
+			want: newRecord("id", int64(1), "at", at),
+		},
+		{
+			name:    "required field missing",
+			rec:     newRecord("name", "x"),
+			wantErr: "field id: required field is missing",
+		},
+		{
+			name:    "required field null",
+			rec:     newRecord("id", nil),
+			wantErr: "field id: required field is missing",
+		},
+		{
+			name:    "value that does not convert",
+			rec:     newRecord("id", "forty-two"),
+			wantErr: `field id: cannot convert "forty-two" to int64`,
+		},
+		{
+			name: "unknown fields are kept",
+			rec:  newRecord("id", int64(1), "extra", "x"),
+			want: newRecord("id", int64(1), "extra", "x"),
+		},
+		{
+			name:    "unknown fields are dropped",
+			unknown: DropUnknown,
+			rec:     newRecord("id", int64(1), "extra", "x", VersionField, int64(1)),
+			want:    newRecord("id", int64(1), VersionField, int64(1)),
+		},
+		{
+			name:    "unknown fields are rejected",
+			unknown: RejectUnknown,
+			rec:     newRecord("id", int64(1), "extra", "x"),
+			wantErr: "field extra: field is not declared",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `{"name": "test", "version": 1, ` + fields
+			if tt.unknown != "" {
+				doc += `, "unknownFields": "` + tt.unknown + `"`
+			}
+			s := mustParse(t, doc+`}`)
+
+			err := s.Validate(tt.rec)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.rec.Fields, tt.want.Fields) {
+				t.Errorf("Validate() fields = %v, want %v", tt.rec.Fields, tt.want.Fields)
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	r := NewRegistry()
+	r.Register(mustParse(t, `{"name": "database_audit_logs", "version": 2, "fields": [],
+		"migrations": [
+			{"op": "rename", "field": "host_name", "to": "client_host"},
+			{"op": "split", "field": "login_name", "into": ["login_domain", "login_user"], "separator": "\\"}
+		]}`))
+	r.Register(mustParse(t, `{"name": "database_audit_logs", "version": 3, "fields": [],
+		"migrations": [
+			{"op": "default", "field": "region", "value": "eu"},
+			{"op": "drop", "field": "role_name"}
+		]}`))
+
+	tests := []struct {
+		name    string
+		version int
+		rec     *record.Record
+		want    *record.Record
+		wantErr string
+	}{
+		{
+			name: "unstamped record is in the target version",
+			rec:  newRecord("host_name", "h", "role_name", "r"),
+			want: newRecord("host_name", "h", "role_name", "r", VersionField, int64(3)),
+		},
+		{
+			name: "every newer version is applied in order",
+			rec:  newRecord(VersionField, int64(1), "host_name", "h", "login_name", `CORP\jane`, "role_name", "r"),
+			want: newRecord(VersionField, int64(3), "client_host", "h", "login_domain", "CORP", "login_user", "jane", "region", "eu"),
+		},
+		{
+			name: "only the versions after the stamp",
+			rec:  newRecord(VersionField, "2", "host_name", "h", "region", "us"),
+			want: newRecord(VersionField, int64(3), "host_name", "h", "region", "us"),
+		},
+		{
+			name:    "up to an older target",
+			version: 2,
+			rec:     newRecord(VersionField, int64(1), "login_name", "jane", "role_name", "r"),
+			want:    newRecord(VersionField, int64(2), "role_name", "r", "login_domain", "", "login_user", "jane"),
+		},
+		{
+			name:    "newer than the target",
+			version: 2,
+			rec:     newRecord(VersionField, int64(3)),
+			wantErr: "version 3 is newer than 2",
+		},
+		{
+			name:    "invalid stamp",
+			rec:     newRecord(VersionField, "v1"),
+			wantErr: `invalid version "v1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := r.Get("database_audit_logs", tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Upgrade(tt.rec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Upgrade() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Upgrade() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.rec.Fields, tt.want.Fields) {
+				t.Errorf("Upgrade() fields = %v, want %v", tt.rec.Fields, tt.want.Fields)
+			}
+		})
+	}
+}
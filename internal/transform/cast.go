@@ -0,0 +1,73 @@
+package transform
+
+import (
+	"fmt"
+	"time"
+
+	"log-pipeline/internal/record"
+)
+
+// Cast converts a field to another type, dropping values that do not convert.
+type Cast struct {
+	Field    string
+	Type     string
+	Layout   string
+	Location *time.Location
+	convert  func(v interface{}) (interface{}, bool)
+}
+
+func NewCast(field, typ, layout, timezone string) (*Cast, error) {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cast{Field: field, Type: typ, Layout: layout, Location: loc}
+	switch typ {
+	case "string":
+		c.convert = func(v interface{}) (interface{}, bool) { return record.String(v), true }
+	case "int":
+		c.convert = toInt
+	case "float":
+		c.convert = toFloat
+	case "bool":
+		c.convert = toBool
+	case "time":
+		if c.Layout == "" {
+			c.Layout = time.RFC3339Nano
+		}
+		c.convert = c.toTime
+	default:
+		return nil, fmt.Errorf("unknown cast type %q", typ)
+	}
+	return c, nil
+}
+
+func (c *Cast) Apply(rec *record.Record) error {
+	value, ok := rec.Fields.Get(c.Field)
+	if !ok {
+		return nil
+	}
+	if value, ok := c.convert(value); ok {
+		rec.Fields.Set(c.Field, value)
+	} else {
+		rec.Fields.Delete(c.Field)
+	}
+	return nil
+}
+
+func toInt(v interface{}) (interface{}, bool) {
+	return record.Int(v)
+}
+
+func toFloat(v interface{}) (interface{}, bool) {
+	return record.Float(v)
+}
+
+func toBool(v interface{}) (interface{}, bool) {
+	return record.Bool(v)
+}
+
+func (c *Cast) toTime(v interface{}) (interface{}, bool) {
+	t, err := parseTime(v, []string{c.Layout}, c.Location)
+	return t, err == nil
+}
@@ -0,0 +1,31 @@
+package transform
+
+import (
+	"strings"
+
+	"log-pipeline/internal/fingerprint"
+	"log-pipeline/internal/record"
+)
+
+// SQLFingerprint adds the fingerprint of the SQL held in Field.
+type SQLFingerprint struct {
+	Field string
+}
+
+func (t SQLFingerprint) Apply(rec *record.Record) error {
+	value, ok := rec.Fields.Get(t.Field)
+	if !ok {
+		return nil
+	}
+	sql, ok := value.(string)
+	if !ok || strings.TrimSpace(sql) == "" {
+		return nil
+	}
+
+	fp := fingerprint.Fingerprint(sql)
+	rec.Fields.Set("sql_fingerprint", fp.Fingerprint)
+	rec.Fields.Set("sql_fingerprint_hash", fp.Hash)
+	rec.Fields.Set("statement_type", fp.StatementType)
+	rec.Fields.Set("sql_objects", strings.Join(fp.Objects, ","))
+	return nil
+}
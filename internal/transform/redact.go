@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"log-pipeline/internal/record"
+	"log-pipeline/internal/redact"
+)
+
+// Redact masks, removes or hashes sensitive values in string fields.
+type Redact struct {
+	Fields   []string
+	Redactor *redact.Redactor
+}
+
+func newRedact(opts Options) (*Redact, error) {
+	fields := withField(opts)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("redact requires field or fields")
+	}
+
+	ropts := opts.Redact
+	if len(ropts.Key) == 0 && opts.KeyFile != "" {
+		key, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redaction key: %v", err)
+		}
+		ropts.Key = bytes.TrimSpace(key)
+	}
+
+	r, err := redact.New(ropts)
+	if err != nil {
+		return nil, err
+	}
+	return &Redact{Fields: fields, Redactor: r}, nil
+}
+
+func (t *Redact) Apply(rec *record.Record) error {
+	for _, field := range t.Fields {
+		value, ok := rec.Fields.Get(field)
+		if !ok {
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if redacted, found := t.Redactor.Redact(s); found {
+			rec.Fields.Set(field, redacted)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"fmt"
+	"time"
+
+	"log-pipeline/internal/record"
+	"log-pipeline/pkg/utils"
+)
+
+// Timestamp sets the record time from a field.
+type Timestamp struct {
+	Field    string
+	Layouts  []string
+	Location *time.Location
+}
+
+// NewTimestamp builds a Timestamp reading field with layouts in timezone.
+func NewTimestamp(field string, layouts []string, timezone string) (*Timestamp, error) {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &Timestamp{Field: field, Layouts: layouts, Location: loc}, nil
+}
+
+func (t *Timestamp) Apply(rec *record.Record) error {
+	value, ok := rec.Fields.Get(t.Field)
+	if !ok {
+		return nil
+	}
+	ts, err := parseTime(value, t.Layouts, t.Location)
+	if err != nil {
+		return nil
+	}
+	rec.Time = ts
+	rec.Fields.Set(t.Field, ts)
+	return nil
+}
+
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+	}
+	return loc, nil
+}
+
+// parseTime converts a field value to a time.
+func parseTime(v interface{}, layouts []string, loc *time.Location) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return utils.EpochTime(v, epochUnit(layouts))
+	case float64:
+		return utils.EpochTimeFloat(v, epochUnit(layouts))
+	default:
+		return utils.ParseTime(record.String(v), layouts, loc)
+	}
+}
+
+func epochUnit(layouts []string) string {
+	for _, layout := range layouts {
+		switch layout {
+		case "unix":
+			return "s"
+		case "unix_ms":
+			return "ms"
+		case "unix_us":
+			return "us"
+		case "unix_ns":
+			return "ns"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,256 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"log-pipeline/internal/record"
+	"log-pipeline/internal/redact"
+	"log-pipeline/pkg/utils"
+)
+
+// Transform changes a record in place.
+type Transform interface {
+	Apply(rec *record.Record) error
+}
+
+// Options selects and configures a Transform.
+type Options struct {
+	// Op is the transform, such as "rename" or "redact"
+	Op string
+	// Field is the field the transform reads or writes
+	Field string
+	// Fields lists the fields of transforms applying to several
+	Fields []string
+	// To is the destination field of "rename" and "copy"
+	To string
+	// Label is the stream label of "field_to_label" and "label_to_field"
+	Label string
+	// Value is the constant written by "set"
+	Value interface{}
+	// Template is the text written by "template", with ${name} placeholders
+	Template string
+	// Type is the type "cast" converts to
+	Type string
+	// Layout is the layout of a "time" cast (default RFC 3339)
+	Layout string
+	// Timezone applies to a "time" cast of times without a zone
+	Timezone string
+	// Redact configures "redact"
+	Redact redact.Options
+	// KeyFile holds the HMAC key of "redact" when Redact.Key is empty
+	KeyFile string
+}
+
+// New builds the Transform described by opts.
+func New(opts Options) (Transform, error) {
+	switch opts.Op {
+	case "rename", "copy":
+		if opts.Field == "" || opts.To == "" {
+			return nil, fmt.Errorf("%s requires field and to", opts.Op)
+		}
+		return Rename{From: opts.Field, To: opts.To, Keep: opts.Op == "copy"}, nil
+	case "drop":
+		fields := withField(opts)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("drop requires field or fields")
+		}
+		return Drop{Fields: fields}, nil
+	case "set":
+		if opts.Field == "" {
+			return nil, fmt.Errorf("set requires field")
+		}
+		return Set{Field: opts.Field, Value: normalize(opts.Value)}, nil
+	case "template":
+		if opts.Field == "" || opts.Template == "" {
+			return nil, fmt.Errorf("template requires field and template")
+		}
+		return Template{Field: opts.Field, Template: opts.Template}, nil
+	case "lowercase", "uppercase", "trim":
+		fields := withField(opts)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s requires field or fields", opts.Op)
+		}
+		return Strings{Fields: fields, Fn: stringFuncs[opts.Op]}, nil
+	case "cast":
+		if opts.Field == "" {
+			return nil, fmt.Errorf("cast requires field")
+		}
+		return NewCast(opts.Field, opts.Type, opts.Layout, opts.Timezone)
+	case "snake_case":
+		return SnakeCase{Fields: withField(opts)}, nil
+	case "field_to_label":
+		if opts.Field == "" || opts.Label == "" {
+			return nil, fmt.Errorf("field_to_label requires field and label")
+		}
+		return FieldToLabel{Field: opts.Field, Label: opts.Label}, nil
+	case "label_to_field":
+		if opts.Field == "" || opts.Label == "" {
+			return nil, fmt.Errorf("label_to_field requires label and field")
+		}
+		return LabelToField{Label: opts.Label, Field: opts.Field}, nil
+	case "redact":
+		return newRedact(opts)
+	case "sql_fingerprint":
+		field := opts.Field
+		if field == "" {
+			field = "text_data"
+		}
+		return SQLFingerprint{Field: field}, nil
+	default:
+		return nil, fmt.Errorf("unknown transform op %q", opts.Op)
+	}
+}
+
+func withField(opts Options) []string {
+	if opts.Field == "" {
+		return opts.Fields
+	}
+	return append([]string{opts.Field}, opts.Fields...)
+}
+
+// normalize turns whole JSON numbers into int64.
+func normalize(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return v
+}
+
+// Rename moves a field to a new name, or copies it when Keep is set.
+type Rename struct {
+	From string
+	To   string
+	Keep bool
+}
+
+func (t Rename) Apply(rec *record.Record) error {
+	if !t.Keep {
+		rec.Fields.Rename(t.From, t.To)
+		return nil
+	}
+	if value, ok := rec.Fields.Get(t.From); ok {
+		rec.Fields.Set(t.To, value)
+	}
+	return nil
+}
+
+// Drop removes fields.
+type Drop struct {
+	Fields []string
+}
+
+func (t Drop) Apply(rec *record.Record) error {
+	for _, field := range t.Fields {
+		rec.Fields.Delete(field)
+	}
+	return nil
+}
+
+// Set writes a constant.
+type Set struct {
+	Field string
+	Value interface{}
+}
+
+func (t Set) Apply(rec *record.Record) error {
+	rec.Fields.Set(t.Field, t.Value)
+	return nil
+}
+
+var placeholder = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Template writes text built from other fields and labels.
+type Template struct {
+	Field    string
+	Template string
+}
+
+func (t Template) Apply(rec *record.Record) error {
+	value := placeholder.ReplaceAllStringFunc(t.Template, func(m string) string {
+		name := m[2 : len(m)-1]
+		if value, ok := rec.Fields.GetString(name); ok {
+			return value
+		}
+		return rec.Labels[name]
+	})
+	rec.Fields.Set(t.Field, value)
+	return nil
+}
+
+var stringFuncs = map[string]func(string) string{
+	"lowercase": strings.ToLower,
+	"uppercase": strings.ToUpper,
+	"trim":      strings.TrimSpace,
+}
+
+// Strings rewrites the string value of fields.
+type Strings struct {
+	Fields []string
+	Fn     func(string) string
+}
+
+func (t Strings) Apply(rec *record.Record) error {
+	for _, field := range t.Fields {
+		if value, ok := rec.Fields.Get(field); ok {
+			if s, ok := value.(string); ok {
+				rec.Fields.Set(field, t.Fn(s))
+			}
+		}
+	}
+	return nil
+}
+
+// SnakeCase renames fields to snake_case, every field when Fields is empty.
+type SnakeCase struct {
+	Fields []string
+}
+
+func (t SnakeCase) Apply(rec *record.Record) error {
+	fields := t.Fields
+	if len(fields) == 0 {
+		fields = rec.Fields.Keys()
+	}
+	for _, field := range fields {
+		name := utils.ToSnakeCase(field)
+		if name == field {
+			continue
+		}
+		if _, taken := rec.Fields.Get(name); taken || name == "" {
+			rec.Fields.Delete(field)
+			continue
+		}
+		rec.Fields.Rename(field, name)
+	}
+	return nil
+}
+
+// FieldToLabel moves a field to a stream label.
+type FieldToLabel struct {
+	Field string
+	Label string
+}
+
+func (t FieldToLabel) Apply(rec *record.Record) error {
+	if value, ok := rec.Fields.GetString(t.Field); ok {
+		rec.Labels[t.Label] = value
+		rec.Fields.Delete(t.Field)
+	}
+	return nil
+}
+
+// LabelToField moves a stream label to a field.
+type LabelToField struct {
+	Label string
+	Field string
+}
+
+func (t LabelToField) Apply(rec *record.Record) error {
+	if value, ok := rec.Labels[t.Label]; ok {
+		rec.Fields.Set(t.Field, value)
+		delete(rec.Labels, t.Label)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package victoria
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/record"
+)
+
+// BatcherStats holds the counters reported by a Batcher.
+type BatcherStats struct {
+	Batches       int64
+	Records       int64
+	Bytes         int64
+	FailedBatches int64
+	FailedRecords int64
+	LastWrite     time.Time
+}
+
+// Rejection is a record VictoriaLogs refused, and why.
+type Rejection struct {
+	Record *record.Record
+	Reason error
+}
+
+// Batcher ships records to one Victoria tenant in batches of up to maxRecords
+// or maxBytes, or whatever was buffered after linger.
+type Batcher struct {
+	ctx        context.Context
+	client     *Client
+	maxRecords int
+	maxBytes   int
+	linger     time.Duration
+
+	// sendMutex keeps batches in order; mutex is not held while sending
+	sendMutex sync.Mutex
+	mutex     sync.Mutex
+	buf       bytes.Buffer
+	records   []*record.Record
+	timer     *time.Timer
+	// failed is the last batch that could not be shipped
+	failed *batch
+	// err is the error of a flush no caller has seen yet
+	err      error
+	rejected []Rejection
+	stats    BatcherStats
+}
+
+// batch is a payload taken out of the buffer to be sent.
+type batch struct {
+	payload []byte
+	records []*record.Record
+}
+
+// NewBatcher creates a batcher writing through client. Cancelling ctx aborts
+// in-flight retries.
+func NewBatcher(ctx context.Context, client *Client, maxRecords, maxBytes int, linger time.Duration) *Batcher {
+	if maxRecords <= 0 {
+		maxRecords = 1000
+	}
+	if maxBytes <= 0 {
+		maxBytes = 4 << 20
+	}
+	return &Batcher{
+		ctx:        ctx,
+		client:     client,
+		maxRecords: maxRecords,
+		maxBytes:   maxBytes,
+		linger:     linger,
+	}
+}
+
+// Add appends a record to the current batch, shipping the batch when full.
+// An error means the record was not buffered.
+func (b *Batcher) Add(rec *record.Record) error {
+	line, err := b.client.encode(rec)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	// Ship first if the line does not fit or the last flush failed
+	if len(b.records) >= b.maxRecords || len(b.records) > 0 && b.buf.Len()+len(line)+1 > b.maxBytes {
+		b.mutex.Unlock()
+		if err := b.flush(); err != nil {
+			return err
+		}
+		b.mutex.Lock()
+	}
+
+	b.buf.Write(line)
+	b.buf.WriteByte('\n')
+	b.records = append(b.records, rec)
+
+	if len(b.records) == 1 && b.linger > 0 {
+		b.timer = time.AfterFunc(b.linger, b.lingerFlush)
+	}
+
+	full := len(b.records) >= b.maxRecords || b.buf.Len() >= b.maxBytes
+	b.mutex.Unlock()
+
+	if full {
+		if err := b.flush(); err != nil {
+			b.keepError(err)
+		}
+	}
+	return nil
+}
+
+// Flush ships the failed batch and the current batch, returning any error
+// since the last Flush.
+func (b *Batcher) Flush() error {
+	err := b.flush()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.err != nil {
+		if err == nil {
+			err = b.err
+		}
+		b.err = nil
+	}
+	return err
+}
+
+// Rejected returns the records VictoriaLogs rejected since the last call.
+func (b *Batcher) Rejected() []Rejection {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	rejected := b.rejected
+	b.rejected = nil
+	return rejected
+}
+
+// Stats returns a snapshot of the batcher counters.
+func (b *Batcher) Stats() BatcherStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+func (b *Batcher) lingerFlush() {
+	if err := b.flush(); err != nil {
+		log.Printf("Failed to flush Victoria batch for tenant %s after linger: %v", b.client.Tenant(), err)
+		b.keepError(err)
+	}
+}
+
+func (b *Batcher) keepError(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// flush resends the failed batch, if any, then ships the current one.
+func (b *Batcher) flush() error {
+	b.sendMutex.Lock()
+	defer b.sendMutex.Unlock()
+
+	for {
+		b.mutex.Lock()
+		next, retry := b.failed, true
+		if next == nil {
+			next, retry = b.takeLocked(), false
+		}
+		b.mutex.Unlock()
+		if next == nil {
+			return nil
+		}
+
+		if err := b.send(next); err != nil {
+			return err
+		}
+		if !retry {
+			return nil
+		}
+	}
+}
+
+// takeLocked empties the buffer into a batch, or returns nil.
+func (b *Batcher) takeLocked() *batch {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.records) == 0 {
+		return nil
+	}
+
+	next := &batch{payload: make([]byte, b.buf.Len()), records: b.records}
+	copy(next.payload, b.buf.Bytes())
+	b.buf.Reset()
+	b.records = nil
+	return next
+}
+
+// send ships a batch, keeping it to resend on failure unless it was rejected.
+func (b *Batcher) send(next *batch) error {
+	count := len(next.records)
+	metrics.BatchRecords.Observe(float64(count))
+	metrics.BatchBytes.Observe(float64(len(next.payload)))
+	err := b.client.send(b.ctx, next.payload)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err != nil {
+		b.stats.FailedBatches++
+		b.stats.FailedRecords += int64(count)
+		if errors.Is(err, errRejected) {
+			b.failed = nil
+			for _, rec := range next.records {
+				b.rejected = append(b.rejected, Rejection{Record: rec, Reason: err})
+			}
+			return nil
+		}
+		b.failed = next
+		return fmt.Errorf("failed to send batch of %d records: %v", count, err)
+	}
+
+	b.failed = nil
+	b.stats.Batches++
+	b.stats.Records += int64(count)
+	b.stats.Bytes += int64(len(next.payload))
+	b.stats.LastWrite = time.Now()
+	return nil
+}
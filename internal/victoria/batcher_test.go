@@ -0,0 +1,173 @@
+package victoria
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitForBatches waits until server stored n batches, as a linger flush runs
+// in the background.
+func waitForBatches(server *fakeVictoria, n int) [][]string {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		batches := server.Batches()
+		if len(batches) >= n || time.Now().After(deadline) {
+			return batches
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatcherFlushTriggers(t *testing.T) {
+	// Each line is {"msg":"a"} and a newline, 12 bytes
+	tests := []struct {
+		name       string
+		maxRecords int
+		maxBytes   int
+		linger     time.Duration
+		add        []string
+		// wantBeforeFlush are the batches shipped by Add and linger
+		wantBeforeFlush [][]string
+		wantAfterFlush  [][]string
+	}{
+		{
+			name:            "record count",
+			maxRecords:      2,
+			add:             []string{"a", "b", "c", "d", "e"},
+			wantBeforeFlush: [][]string{{"a", "b"}, {"c", "d"}},
+			wantAfterFlush:  [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			name:            "bytes",
+			maxBytes:        30,
+			add:             []string{"a", "b", "c", "d", "e"},
+			wantBeforeFlush: [][]string{{"a", "b"}, {"c", "d"}},
+			wantAfterFlush:  [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			name:            "a record over maxBytes ships alone",
+			maxBytes:        5,
+			add:             []string{"a", "b"},
+			wantBeforeFlush: [][]string{{"a"}, {"b"}},
+			wantAfterFlush:  [][]string{{"a"}, {"b"}},
+		},
+		{
+			name:            "linger",
+			linger:          10 * time.Millisecond,
+			add:             []string{"a", "b"},
+			wantBeforeFlush: [][]string{{"a", "b"}},
+			wantAfterFlush:  [][]string{{"a", "b"}},
+		},
+		{
+			name:           "nothing before Flush",
+			add:            []string{"a", "b"},
+			wantAfterFlush: [][]string{{"a", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeVictoria(t)
+			client := NewClient("batcher", server.URL, FieldMapping{MsgField: "msg"}, Tenant{})
+			b := NewBatcher(context.Background(), client, tt.maxRecords, tt.maxBytes, tt.linger)
+
+			for _, msg := range tt.add {
+				if err := b.Add(newRecord(msg, nil)); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			if got := waitForBatches(server, len(tt.wantBeforeFlush)); !reflect.DeepEqual(got, tt.wantBeforeFlush) {
+				t.Errorf("before Flush: batches = %v, want %v", got, tt.wantBeforeFlush)
+			}
+
+			if err := b.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+			if got := server.Batches(); !reflect.DeepEqual(got, tt.wantAfterFlush) {
+				t.Errorf("after Flush: batches = %v, want %v", got, tt.wantAfterFlush)
+			}
+			if stats := b.Stats(); stats.Batches != int64(len(tt.wantAfterFlush)) || stats.Records != int64(len(tt.add)) {
+				t.Errorf("Stats() = %+v, want %d records in %d batches", stats, len(tt.add), len(tt.wantAfterFlush))
+			}
+		})
+	}
+}
+
+func TestBatcherResendsFailedBatchFirst(t *testing.T) {
+	server := newFakeVictoria(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	server.status = func(request int) int {
+		if request == 1 {
+			// Stop the retries, so the batch is kept as failed
+			cancel()
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	}
+	client := NewClient("batcher-resend", server.URL, FieldMapping{MsgField: "msg"}, Tenant{})
+	b := NewBatcher(ctx, client, 2, 0, 0)
+
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := b.Add(newRecord(msg, nil)); err != nil {
+			t.Fatalf("Add(%s) error = %v", msg, err)
+		}
+	}
+	if got := server.Batches(); len(got) != 0 {
+		t.Fatalf("batches after the failed flush = %v, want none", got)
+	}
+
+	// A new context, as for the next run of the processing loop
+	b.ctx = context.Background()
+	if err := b.Add(newRecord("d", nil)); err != nil {
+		t.Fatalf("Add(d) error = %v", err)
+	}
+	if err := b.Flush(); err == nil {
+		t.Error("Flush() error = nil, want the error of the failed flush")
+	}
+	if err := b.Flush(); err != nil {
+		t.Errorf("second Flush() error = %v", err)
+	}
+
+	want := [][]string{{"a", "b"}, {"c", "d"}}
+	if got := server.Batches(); !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+	if stats := b.Stats(); stats.Batches != 2 || stats.FailedBatches != 1 || stats.FailedRecords != 2 {
+		t.Errorf("Stats() = %+v, want 2 batches and 1 failed batch of 2 records", stats)
+	}
+}
+
+func TestBatcherRejected(t *testing.T) {
+	server := newFakeVictoria(t)
+	server.status = func(request int) int {
+		if request == 1 {
+			return http.StatusBadRequest
+		}
+		return http.StatusNoContent
+	}
+	client := NewClient("batcher-rejected", server.URL, FieldMapping{MsgField: "msg"}, Tenant{})
+	b := NewBatcher(context.Background(), client, 2, 0, 0)
+
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := b.Add(newRecord(msg, nil)); err != nil {
+			t.Fatalf("Add(%s) error = %v", msg, err)
+		}
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	rejected := b.Rejected()
+	if len(rejected) != 2 || rejected[0].Record.Raw != "a" || rejected[1].Record.Raw != "b" || rejected[0].Reason == nil {
+		t.Errorf("Rejected() = %v, want a and b with a reason", rejected)
+	}
+	if again := b.Rejected(); len(again) != 0 {
+		t.Errorf("second Rejected() = %v, want none", again)
+	}
+	if got, want := server.Batches(), [][]string{{"c"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+}
@@ -2,56 +2,165 @@ package victoria
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/record"
 	"log-pipeline/internal/resilience"
 )
 
+// errRejected marks a payload refused with a 4xx status.
+var errRejected = errors.New("payload rejected")
+
+// FieldMapping names the message, time and stream fields of a JSON line.
+type FieldMapping struct {
+	MsgField     string
+	TimeField    string
+	StreamFields []string
+}
+
+// Client writes to one tenant of a VictoriaLogs, with its own circuit breaker.
 type Client struct {
+	name       string
 	baseURL    string
-	schema     string
+	mapping    FieldMapping
+	tenant     Tenant
 	httpClient *http.Client
 	maxRetries int
 	cb         *resilience.CircuitBreaker
+	tenants    *tenantClients
+}
+
+// tenantClients holds the clients of every tenant written to so far.
+type tenantClients struct {
+	mutex    sync.Mutex
+	byTenant map[Tenant]*Client
 }
 
-func NewClient(baseURL, schema string) *Client {
-	return &Client{
-		baseURL: baseURL,
-		schema:  schema,
+// NewClient creates a client for the VictoriaLogs at baseURL.
+func NewClient(name, baseURL string, mapping FieldMapping, tenant Tenant) *Client {
+	c := &Client{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		mapping: mapping,
+		tenant:  tenant,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 		maxRetries: 3,
-		cb:         resilience.NewCircuitBreaker("victoria-client"),
+		cb:         resilience.NewCircuitBreaker("victoria-" + name),
+		tenants:    &tenantClients{byTenant: make(map[Tenant]*Client)},
 	}
+	c.tenants.byTenant[tenant] = c
+	return c
 }
 
-func (c *Client) SendLog(data map[string]interface{}) error {
-	operation := func() error {
-		// Add schema information
-		data["_schema"] = c.schema
+// Tenant returns the tenant the client writes to.
+func (c *Client) Tenant() Tenant {
+	return c.tenant
+}
+
+// ForTenant returns the client writing to tenant, creating it on first use.
+func (c *Client) ForTenant(tenant Tenant) *Client {
+	c.tenants.mutex.Lock()
+	defer c.tenants.mutex.Unlock()
+
+	if client, ok := c.tenants.byTenant[tenant]; ok {
+		return client
+	}
+	client := *c
+	client.tenant = tenant
+	client.cb = resilience.NewCircuitBreaker("victoria-" + c.name + "-" + tenant.String())
+	c.tenants.byTenant[tenant] = &client
+	return &client
+}
+
+// SendLog ships a single record to VictoriaLogs as one JSON line.
+func (c *Client) SendLog(ctx context.Context, rec *record.Record) error {
+	payload, err := c.encode(rec)
+	if err != nil {
+		return err
+	}
+	payload = append(payload, '\n')
 
-		payload, err := json.Marshal(data)
-		if err != nil {
-			return fmt.Errorf("failed to marshal data: %v", err)
+	return c.send(ctx, payload)
+}
+
+// encode marshals a record as one JSON line, filling stream fields from labels.
+func (c *Client) encode(rec *record.Record) ([]byte, error) {
+	if c.mapping.TimeField != "" && !rec.Time.IsZero() {
+		rec.Fields.Set(c.mapping.TimeField, rec.Time)
+	}
+	for _, name := range c.mapping.StreamFields {
+		if _, ok := rec.Fields.Get(name); ok {
+			continue
 		}
+		if value, ok := rec.Labels[name]; ok {
+			rec.Fields.Set(name, value)
+		}
+	}
+	line, err := json.Marshal(rec.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %v", err)
+	}
+	return line, nil
+}
+
+// insertURL builds the /insert/jsonline URL with the field mapping.
+func (c *Client) insertURL() string {
+	params := url.Values{}
+	if c.mapping.MsgField != "" {
+		params.Set("_msg_field", c.mapping.MsgField)
+	}
+	if c.mapping.TimeField != "" {
+		params.Set("_time_field", c.mapping.TimeField)
+	}
+	if len(c.mapping.StreamFields) > 0 {
+		params.Set("_stream_fields", strings.Join(c.mapping.StreamFields, ","))
+	}
 
-		url := fmt.Sprintf("%s/write", c.baseURL)
+	return fmt.Sprintf("%s/insert/jsonline?%s", c.baseURL, params.Encode())
+}
 
+// send posts a JSON lines payload with retries. A 4xx other than 429 is not
+// retried and does not trip the breaker.
+func (c *Client) send(ctx context.Context, payload []byte) error {
+	url := c.insertURL()
+
+	var rejected error
+	operation := func() error {
 		// Execute request through circuit breaker
-		_, err = c.cb.Execute(func() (interface{}, error) {
-			req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+		_, err := c.cb.Execute(func() (_ interface{}, err error) {
+			defer func(start time.Time) {
+				if rejected != nil {
+					metrics.ObserveRequest(c.name, "victoria", start, rejected)
+				} else {
+					metrics.ObserveRequest(c.name, "victoria", start, err)
+				}
+			}(time.Now())
+
+			req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
 			if err != nil {
 				return nil, fmt.Errorf("failed to create request: %v", err)
 			}
 
-			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Type", "application/stream+json")
+			if c.tenant != (Tenant{}) {
+				req.Header.Set("AccountID", strconv.FormatUint(uint64(c.tenant.AccountID), 10))
+				req.Header.Set("ProjectID", strconv.FormatUint(uint64(c.tenant.ProjectID), 10))
+			}
 
 			resp, err := c.httpClient.Do(req)
 			if err != nil {
@@ -59,13 +168,23 @@ func (c *Client) SendLog(data map[string]interface{}) error {
 			}
 			defer resp.Body.Close()
 
-			if resp.StatusCode != http.StatusOK {
-				return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+				body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+				err := fmt.Errorf("server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+				if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+					// The payload is at fault, not the server
+					rejected = err
+					return nil, nil
+				}
+				return nil, err
 			}
 
 			return nil, nil
 		})
 
+		if rejected != nil {
+			return backoff.Permanent(rejected)
+		}
 		return err
 	}
 
@@ -73,15 +192,34 @@ func (c *Client) SendLog(data map[string]interface{}) error {
 	b := backoff.NewExponentialBackOff()
 	b.MaxElapsedTime = 2 * time.Minute
 
-	err := backoff.RetryNotify(func() error {
-		return operation()
-	}, b, func(err error, duration time.Duration) {
-		log.Printf("Retrying Victoria log send after %v due to error: %v", duration, err)
+	err := backoff.RetryNotify(operation, backoff.WithContext(b, ctx), func(err error, duration time.Duration) {
+		metrics.Retries.Inc(c.name, "victoria")
+		log.Printf("Retrying Victoria log send to tenant %s after %v due to error: %v", c.tenant, duration, err)
 	})
 
+	if rejected != nil {
+		return fmt.Errorf("%w: %v", errRejected, rejected)
+	}
 	if err != nil {
 		return fmt.Errorf("all retries failed: %v", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// BreakerState returns the state of the client's circuit breaker.
+func (c *Client) BreakerState() string {
+	return c.cb.State().String()
+}
+
+// BreakerStates returns the breaker state of every tenant written to.
+func (c *Client) BreakerStates() map[Tenant]string {
+	c.tenants.mutex.Lock()
+	defer c.tenants.mutex.Unlock()
+
+	states := make(map[Tenant]string, len(c.tenants.byTenant))
+	for tenant, client := range c.tenants.byTenant {
+		states[tenant] = client.BreakerState()
+	}
+	return states
+}
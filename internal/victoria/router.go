@@ -0,0 +1,131 @@
+package victoria
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/record"
+)
+
+// Writer ships records to VictoriaLogs.
+type Writer interface {
+	Add(rec *record.Record) error
+	Flush() error
+	// Rejected drains the records Victoria rejected
+	Rejected() []Rejection
+	Stats() BatcherStats
+}
+
+// Router batches each record for the tenant its selector picks, falling back
+// to the tenant of the client.
+type Router struct {
+	ctx        context.Context
+	client     *Client
+	selector   TenantSelector
+	maxRecords int
+	maxBytes   int
+	linger     time.Duration
+
+	mutex    sync.Mutex
+	batchers map[Tenant]*Batcher
+}
+
+// NewRouter creates a router with one batcher per tenant, as for NewBatcher.
+func NewRouter(ctx context.Context, client *Client, selector TenantSelector, maxRecords, maxBytes int, linger time.Duration) *Router {
+	return &Router{
+		ctx:        ctx,
+		client:     client,
+		selector:   selector,
+		maxRecords: maxRecords,
+		maxBytes:   maxBytes,
+		linger:     linger,
+		batchers:   make(map[Tenant]*Batcher),
+	}
+}
+
+// Add appends a record to the batch of its tenant.
+func (r *Router) Add(rec *record.Record) error {
+	var b *Batcher
+	tenant, ok := r.selector.Tenant(rec)
+	if ok {
+		b, ok = r.batcher(tenant)
+	}
+	if !ok {
+		metrics.TenantFallbacks.Inc(r.client.name)
+		b, _ = r.batcher(r.client.Tenant())
+	}
+	return b.Add(rec)
+}
+
+// Flush ships the batch of every tenant and returns the first error.
+func (r *Router) Flush() error {
+	var first error
+	for _, b := range r.snapshot() {
+		if err := b.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Rejected returns the records every tenant rejected since the last call.
+func (r *Router) Rejected() []Rejection {
+	var rejected []Rejection
+	for _, b := range r.snapshot() {
+		rejected = append(rejected, b.Rejected()...)
+	}
+	return rejected
+}
+
+// Stats returns the counters of every tenant added together.
+func (r *Router) Stats() BatcherStats {
+	var total BatcherStats
+	for _, b := range r.snapshot() {
+		stats := b.Stats()
+		total.Batches += stats.Batches
+		total.Records += stats.Records
+		total.Bytes += stats.Bytes
+		total.FailedBatches += stats.FailedBatches
+		total.FailedRecords += stats.FailedRecords
+		if stats.LastWrite.After(total.LastWrite) {
+			total.LastWrite = stats.LastWrite
+		}
+	}
+	return total
+}
+
+// batcher returns the batcher of tenant, or false past MaxTenants.
+func (r *Router) batcher(tenant Tenant) (b *Batcher, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if b, ok := r.batchers[tenant]; ok {
+		return b, true
+	}
+	if tenant != r.client.Tenant() && len(r.selector.Tenants) == 0 && r.selector.MaxTenants > 0 {
+		parsed := len(r.batchers)
+		if _, ok := r.batchers[r.client.Tenant()]; ok {
+			parsed--
+		}
+		if parsed >= r.selector.MaxTenants {
+			return nil, false
+		}
+	}
+
+	b = NewBatcher(r.ctx, r.client.ForTenant(tenant), r.maxRecords, r.maxBytes, r.linger)
+	r.batchers[tenant] = b
+	return b, true
+}
+
+func (r *Router) snapshot() []*Batcher {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	batchers := make([]*Batcher, 0, len(r.batchers))
+	for _, b := range r.batchers {
+		batchers = append(batchers, b)
+	}
+	return batchers
+}
@@ -0,0 +1,261 @@
+package victoria
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/record"
+)
+
+// fakeVictoria stores the "msg" field of every line posted to
+// /insert/jsonline, by the tenant of the request and by batch. status, when
+// set, picks the response to each request from its 1-based number; a batch
+// is only stored when the response is a success.
+type fakeVictoria struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	requests int
+	status   func(request int) int
+	received map[Tenant][]string
+	batches  [][]string
+}
+
+func newFakeVictoria(t *testing.T) *fakeVictoria {
+	v := &fakeVictoria{received: make(map[Tenant][]string)}
+	v.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/insert/jsonline" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		account, _ := strconv.ParseUint(r.Header.Get("AccountID"), 10, 32)
+		project, _ := strconv.ParseUint(r.Header.Get("ProjectID"), 10, 32)
+		tenant := Tenant{AccountID: uint32(account), ProjectID: uint32(project)}
+
+		v.mutex.Lock()
+		defer v.mutex.Unlock()
+		v.requests++
+		if v.status != nil {
+			if status := v.status(v.requests); status != http.StatusNoContent {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		var batch []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var fields struct{ Msg string }
+			if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+				t.Errorf("invalid line %q: %v", scanner.Text(), err)
+			}
+			batch = append(batch, fields.Msg)
+		}
+		v.received[tenant] = append(v.received[tenant], batch...)
+		v.batches = append(v.batches, batch)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(v.Close)
+	return v
+}
+
+// Batches returns the batches stored so far.
+func (v *fakeVictoria) Batches() [][]string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return append([][]string(nil), v.batches...)
+}
+
+// newRecord returns a record with msg and the given fields and labels, both
+// as name, value pairs.
+func newRecord(msg string, fields []string, labels ...string) *record.Record {
+	rec := record.New(time.Time{}, nil, msg)
+	rec.Fields.Set("msg", msg)
+	for i := 0; i < len(fields); i += 2 {
+		rec.Fields.Set(fields[i], fields[i+1])
+	}
+	if len(labels) > 0 {
+		rec.Labels = make(map[string]string)
+		for i := 0; i < len(labels); i += 2 {
+			rec.Labels[labels[i]] = labels[i+1]
+		}
+	}
+	return rec
+}
+
+// tenantFallbacks reads the tenant fallback counter of pipeline.
+func tenantFallbacks(pipeline string) float64 {
+	var b bytes.Buffer
+	metrics.Default.Write(&b)
+	prefix := `log_pipeline_tenant_fallbacks_total{pipeline="` + pipeline + `"} `
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			value, _ := strconv.ParseFloat(line[len(prefix):], 64)
+			return value
+		}
+	}
+	return 0
+}
+
+func TestRouter(t *testing.T) {
+	allowList := TenantSelector{
+		Field:   "tenant",
+		Tenants: map[string]Tenant{"audit": {AccountID: 1}, "ops": {AccountID: 2, ProjectID: 1}},
+	}
+
+	tests := []struct {
+		name     string
+		selector TenantSelector
+		// tenant is the tenant of the client
+		tenant  Tenant
+		records []*record.Record
+		want    map[Tenant][]string
+		// wantFallbacks is the records written to the client tenant
+		// because they had no routable one
+		wantFallbacks float64
+	}{
+		{
+			name:     "allow-list",
+			selector: allowList,
+			records: []*record.Record{
+				newRecord("a", []string{"tenant", "audit"}),
+				newRecord("b", []string{"tenant", "ops"}),
+				newRecord("c", []string{"tenant", "audit"}),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 1}:               {"a", "c"},
+				{AccountID: 2, ProjectID: 1}: {"b"},
+			},
+			wantFallbacks: 0,
+		},
+		{
+			name:     "values outside the allow-list fall back",
+			selector: allowList,
+			tenant:   Tenant{AccountID: 9},
+			records: []*record.Record{
+				newRecord("a", []string{"tenant", "audit"}),
+				newRecord("b", []string{"tenant", "dev"}),
+				newRecord("c", []string{"tenant", "2:1"}),
+				newRecord("d", nil),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 1}: {"a"},
+				{AccountID: 9}: {"b", "c", "d"},
+			},
+			wantFallbacks: 3,
+		},
+		{
+			name:     "label when the field is missing",
+			selector: TenantSelector{Field: "tenant", Label: "tenant", Tenants: allowList.Tenants},
+			records: []*record.Record{
+				newRecord("a", nil, "tenant", "ops"),
+				newRecord("b", []string{"tenant", "audit"}, "tenant", "ops"),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 2, ProjectID: 1}: {"a"},
+				{AccountID: 1}:               {"b"},
+			},
+			wantFallbacks: 0,
+		},
+		{
+			name:     "parsed tenants",
+			selector: TenantSelector{Field: "tenant"},
+			records: []*record.Record{
+				newRecord("a", []string{"tenant", "3"}),
+				newRecord("b", []string{"tenant", "3:4"}),
+				newRecord("c", []string{"tenant", "three"}),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 3}:               {"a"},
+				{AccountID: 3, ProjectID: 4}: {"b"},
+				{}:                           {"c"},
+			},
+			wantFallbacks: 1,
+		},
+		{
+			name:     "MaxTenants caps parsed tenants",
+			selector: TenantSelector{Field: "tenant", MaxTenants: 2},
+			records: []*record.Record{
+				newRecord("a", []string{"tenant", "1"}),
+				newRecord("b", []string{"tenant", "2"}),
+				newRecord("c", []string{"tenant", "3"}),
+				newRecord("d", []string{"tenant", "1"}),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 1}: {"a", "d"},
+				{AccountID: 2}: {"b"},
+				{}:             {"c"},
+			},
+			wantFallbacks: 1,
+		},
+		{
+			name:     "the client tenant does not count against MaxTenants",
+			selector: TenantSelector{Field: "tenant", MaxTenants: 2},
+			tenant:   Tenant{AccountID: 5},
+			records: []*record.Record{
+				newRecord("a", []string{"tenant", "5"}),
+				newRecord("b", []string{"tenant", "1"}),
+				newRecord("c", []string{"tenant", "2"}),
+				newRecord("d", nil),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 5}: {"a", "d"},
+				{AccountID: 1}: {"b"},
+				{AccountID: 2}: {"c"},
+			},
+			wantFallbacks: 1,
+		},
+		{
+			name:     "MaxTenants does not apply to an allow-list",
+			selector: TenantSelector{Field: "tenant", Tenants: allowList.Tenants, MaxTenants: 1},
+			records: []*record.Record{
+				newRecord("a", []string{"tenant", "audit"}),
+				newRecord("b", []string{"tenant", "ops"}),
+			},
+			want: map[Tenant][]string{
+				{AccountID: 1}:               {"a"},
+				{AccountID: 2, ProjectID: 1}: {"b"},
+			},
+			wantFallbacks: 0,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeVictoria(t)
+			name := "router-" + strconv.Itoa(i)
+			client := NewClient(name, server.URL, FieldMapping{MsgField: "msg"}, tt.tenant)
+			r := NewRouter(context.Background(), client, tt.selector, 100, 0, 0)
+			fallbacks := tenantFallbacks(name)
+
+			for _, rec := range tt.records {
+				if err := r.Add(rec); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			if err := r.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(server.received, tt.want) {
+				t.Errorf("received %v, want %v", server.received, tt.want)
+			}
+			if got := tenantFallbacks(name) - fallbacks; got != tt.wantFallbacks {
+				t.Errorf("tenant fallbacks = %v, want %v", got, tt.wantFallbacks)
+			}
+			if got := r.Stats().Records; got != int64(len(tt.records)) {
+				t.Errorf("Stats().Records = %d, want %d", got, len(tt.records))
+			}
+		})
+	}
+}
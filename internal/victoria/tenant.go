@@ -0,0 +1,74 @@
+package victoria
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"log-pipeline/internal/record"
+)
+
+// Tenant is a VictoriaLogs AccountID and ProjectID; the zero value is the default.
+type Tenant struct {
+	AccountID uint32
+	ProjectID uint32
+}
+
+// ParseTenant parses "accountID" or "accountID:projectID".
+func ParseTenant(s string) (Tenant, error) {
+	account, project, hasProject := strings.Cut(strings.TrimSpace(s), ":")
+	accountID, err := strconv.ParseUint(account, 10, 32)
+	if err != nil {
+		return Tenant{}, fmt.Errorf("invalid tenant %q: bad accountID", s)
+	}
+	t := Tenant{AccountID: uint32(accountID)}
+	if hasProject {
+		projectID, err := strconv.ParseUint(project, 10, 32)
+		if err != nil {
+			return Tenant{}, fmt.Errorf("invalid tenant %q: bad projectID", s)
+		}
+		t.ProjectID = uint32(projectID)
+	}
+	return t, nil
+}
+
+func (t Tenant) String() string {
+	return fmt.Sprintf("%d:%d", t.AccountID, t.ProjectID)
+}
+
+// TenantSelector picks the tenant of a record from a field or label, looked up
+// in Tenants or, without them, parsed.
+type TenantSelector struct {
+	Field   string
+	Label   string
+	Tenants map[string]Tenant
+	// MaxTenants caps the parsed tenants; zero means unbounded
+	MaxTenants int
+}
+
+// Dynamic reports whether the selector routes records at all.
+func (s TenantSelector) Dynamic() bool {
+	return s.Field != "" || s.Label != ""
+}
+
+// Tenant returns the tenant of rec, if it names a valid one.
+func (s TenantSelector) Tenant(rec *record.Record) (t Tenant, ok bool) {
+	var value string
+	if s.Field != "" {
+		if v, found := rec.Fields.Get(s.Field); found && v != nil {
+			value = record.String(v)
+		}
+	}
+	if value == "" && s.Label != "" {
+		value = rec.Labels[s.Label]
+	}
+	if value == "" {
+		return Tenant{}, false
+	}
+	if len(s.Tenants) > 0 {
+		t, ok := s.Tenants[value]
+		return t, ok
+	}
+	t, err := ParseTenant(value)
+	return t, err == nil
+}
@@ -1,20 +1,40 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"log-pipeline/config"
+	"log-pipeline/internal/checkpoint"
 	"log-pipeline/internal/health"
-	"log-pipeline/internal/loki"
-	"log-pipeline/internal/processor"
-	"log-pipeline/internal/victoria"
-	"log-pipeline/pkg/utils"
+	"log-pipeline/internal/httpauth"
+	"log-pipeline/internal/pipeline"
+	"log-pipeline/internal/push"
+	"log-pipeline/internal/schema"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backfill":
+			runBackfill(os.Args[2:])
+			return
+		case "schema-diff":
+			runSchemaDiff(os.Args[2:])
+			return
+		case "infer-schema":
+			runInferSchema(os.Args[2:])
+			return
+		}
+	}
+
 	configPath := flag.String("config", "config.json", "Path to configuration file")
 	flag.Parse()
 
@@ -26,62 +46,172 @@ func main() {
 
 	// Check service health
 	healthChecker := health.NewHealthChecker()
-	if err := healthChecker.CheckLokiHealth(cfg.Loki.URL); err != nil {
-		log.Fatalf("Loki health check failed: %v", err)
-	}
-	if err := healthChecker.CheckVictoriaHealth(cfg.Victoria.URL); err != nil {
-		log.Fatalf("Victoria health check failed: %v", err)
+	for _, p := range cfg.Pipelines {
+		// Push-mode pipelines only write to Victoria
+		if p.Loki.Mode == "push" {
+			if err := healthChecker.CheckVictoriaHealth(p.Victoria.URL); err != nil {
+				log.Fatalf("Victoria health check failed: %v", err)
+			}
+			healthChecker.WatchVictoria(p.Victoria.URL)
+			continue
+		}
+		if err := healthChecker.SetAuth(p.Loki.URL, pipeline.LokiAuth(p.Loki)); err != nil {
+			log.Fatalf("Invalid Loki auth for pipeline %s: %v", p.Name, err)
+		}
+		if err := healthChecker.CheckLokiHealth(p.Loki.URL); err != nil {
+			log.Fatalf("Loki health check failed: %v", err)
+		}
+		if err := healthChecker.CheckVictoriaHealth(p.Victoria.URL); err != nil {
+			log.Fatalf("Victoria health check failed: %v", err)
+		}
+		healthChecker.WatchLoki(p.Loki.URL)
+		healthChecker.WatchVictoria(p.Victoria.URL)
 	}
 
 	log.Printf("Services health check passed")
 
-	// Initialize clients
-	lokiClient := loki.NewClient(cfg.Loki.URL)
-	victoriaClient := victoria.NewClient(cfg.Victoria.URL, cfg.Victoria.Schema)
+	schemas, err := loadSchemas(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
 
-	// Initialize processor
-	proc := processor.NewProcessor(lokiClient, victoriaClient)
+	// Stop fetching on SIGINT/SIGTERM but keep writing long enough to drain
+	ctx, writeCtx, cancel := signalContexts(time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	checkpoints, err := checkpoint.NewFileStore(cfg.CheckpointFile)
+	if err != nil {
+		log.Fatalf("Failed to open checkpoint store: %v", err)
+	}
+	// Move the watermark keyed by query to the default pipeline
+	if len(cfg.Pipelines) == 1 && cfg.Pipelines[0].Name == "default" {
+		pc := cfg.Pipelines[0]
+		moved, err := checkpoints.Rename(pc.Loki.Query, pc.Name)
+		if err != nil {
+			log.Fatalf("Failed to migrate checkpoint: %v", err)
+		}
+		if moved {
+			log.Printf("[%s] Migrated the checkpoint of query %s", pc.Name, pc.Loki.Query)
+		}
+	}
+
+	// Initialize pipelines
+	var pipelines []*pipeline.Pipeline
+	for _, pc := range cfg.Pipelines {
+		p, err := pipeline.New(writeCtx, pc, checkpoints, schemas)
+		if err != nil {
+			log.Fatalf("Failed to create pipeline %s: %v", pc.Name, err)
+		}
+		defer p.Close()
+		pipelines = append(pipelines, p)
+	}
+
+	// Watch dependencies in the background so probes never call out
+	go healthChecker.Watch(ctx, time.Duration(cfg.HealthCheckInterval))
 
 	// Start health check server
-	go func() {
-		http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-			if err := healthChecker.CheckLokiHealth(cfg.Loki.URL); err != nil {
-				http.Error(w, "Loki health check failed", http.StatusServiceUnavailable)
-				return
+	server := &statusServer{
+		healthChecker:   healthChecker,
+		pipelines:       pipelines,
+		started:         time.Now(),
+		livenessTimeout: time.Duration(cfg.LivenessTimeout),
+	}
+	go server.serve(":8080")
+
+	// Receive pushes for the push-mode pipelines
+	var targets []push.Target
+	for _, p := range pipelines {
+		if p.Config().Loki.Mode == "push" {
+			targets = append(targets, p.PushTarget())
+		}
+	}
+	var pushServer *http.Server
+	if len(targets) > 0 {
+		var auth *httpauth.Verifier
+		if cfg.Push.Open() {
+			log.Printf("WARNING: the push receiver on %s accepts unauthenticated pushes; set push.auth to restrict it", cfg.Push.Addr)
+		} else {
+			auth, err = httpauth.NewVerifier(httpauth.Options{
+				Tenants:         cfg.Push.Auth.Tenants,
+				Username:        cfg.Push.Auth.Username,
+				Password:        cfg.Push.Auth.Password,
+				BearerTokenFile: cfg.Push.Auth.BearerTokenFile,
+			})
+			if err != nil {
+				log.Fatalf("Invalid push auth: %v", err)
 			}
-			if err := healthChecker.CheckVictoriaHealth(cfg.Victoria.URL); err != nil {
-				http.Error(w, "Victoria health check failed", http.StatusServiceUnavailable)
+		}
+		pushServer = servePush(cfg.Push.Addr, push.NewHandler(targets, cfg.Push.MaxBodyBytes, auth))
+	}
+
+	// Stats reporting ticker
+	statsTicker := time.NewTicker(1 * time.Minute)
+	defer statsTicker.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
 				return
+			case <-statsTicker.C:
+				for _, p := range pipelines {
+					p.LogStats()
+				}
 			}
-			w.WriteHeader(http.StatusOK)
-		})
-		if err := http.ListenAndServe(":8080", nil); err != nil {
-			log.Printf("Health check server error: %v", err)
 		}
 	}()
 
-	log.Printf("Starting log pipeline with query: %s", cfg.Loki.Query)
-	log.Printf("Time window: %v, Interval: %v", time.Duration(cfg.TimeWindow), time.Duration(cfg.Loki.Interval))
+	// Run every pipeline until shutdown
+	var wg sync.WaitGroup
+	for _, p := range pipelines {
+		wg.Add(1)
+		go func(p *pipeline.Pipeline) {
+			defer wg.Done()
+			p.Run(ctx)
+		}(p)
+	}
+	wg.Wait()
 
-	// Stats reporting ticker
-	statsTicker := time.NewTicker(1 * time.Minute)
-	defer statsTicker.Stop()
+	if pushServer != nil {
+		// Finish the pushes in flight before draining
+		if err := pushServer.Shutdown(writeCtx); err != nil {
+			log.Printf("Push receiver shutdown: %v", err)
+		}
+	}
 
-	// Main processing loop
-	for {
-		select {
-		case <-statsTicker.C:
-			processed, errors, skipped := proc.GetStats()
-			log.Printf("Stats - Processed: %d, Errors: %d, Skipped: %d", processed, errors, skipped)
-		default:
-			start, end := utils.GetTimeRange(time.Duration(cfg.TimeWindow))
-			log.Printf("Processing logs from %v to %v", start, end)
-
-			if err := proc.ProcessLogs(cfg.Loki.Query, start, end); err != nil {
-				log.Printf("Error processing logs: %v", err)
-			}
+	for _, p := range pipelines {
+		p.Drain()
+		if watermark, ok, err := checkpoints.Load(p.Name()); err == nil && ok {
+			log.Printf("[%s] Watermark at %v", p.Name(), watermark)
+		}
+	}
+	log.Printf("Shutdown complete")
+}
 
-			time.Sleep(time.Duration(cfg.Loki.Interval))
+// loadSchemas builds the schema registry with the configured schema files.
+func loadSchemas(cfg *config.Config) (*schema.Registry, error) {
+	schemas := schema.NewRegistry()
+	for _, path := range cfg.SchemaFiles {
+		if err := schemas.LoadFile(path); err != nil {
+			return nil, err
 		}
 	}
-}
\ No newline at end of file
+	return schemas, nil
+}
+
+// signalContexts returns a context cancelled on SIGINT or SIGTERM, and one for
+// writes cancelled shutdownTimeout later.
+func signalContexts(shutdownTimeout time.Duration) (ctx, writeCtx context.Context, cancel func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	writeCtx, cancelWrites := context.WithCancel(context.Background())
+
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down, draining buffered records for up to %v", shutdownTimeout)
+		time.AfterFunc(shutdownTimeout, cancelWrites)
+	}()
+
+	return ctx, writeCtx, func() {
+		stop()
+		cancelWrites()
+	}
+}
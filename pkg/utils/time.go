@@ -1,15 +1,116 @@
 package utils
 
 import (
-    "time"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// SQLServerTimeLayout is the layout of StartTime in SQL Server traces.
+const SQLServerTimeLayout = "01/02/2006 15:04:05"
+
 func GetTimeRange(window time.Duration) (time.Time, time.Time) {
-    end := time.Now()
-    start := end.Add(-window)
-    return start, end
+	end := time.Now()
+	start := end.Add(-window)
+	return start, end
 }
 
 func ParseTimeString(timeStr string) (time.Time, error) {
-    return time.Parse("01/02/2006 15:04:05", timeStr)
+	return time.Parse(SQLServerTimeLayout, timeStr)
+}
+
+// ParseTime parses s with the first matching Go or epoch layout, in loc.
+func ParseTime(s string, layouts []string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range layouts {
+		if unit, ok := epochLayouts[layout]; ok {
+			if t, err := ParseEpoch(s, unit); err == nil {
+				return t, nil
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := ParseEpoch(s, ""); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("time %q matches none of the layouts %q", s, layouts)
+}
+
+var epochLayouts = map[string]string{
+	"epoch":   "",
+	"unix":    "s",
+	"unix_ms": "ms",
+	"unix_us": "us",
+	"unix_ns": "ns",
+}
+
+// ParseEpoch parses a Unix time in unit, or a detected one when it is empty.
+func ParseEpoch(s, unit string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	// Nanosecond epochs do not survive a float64
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return EpochTime(n, unit)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid epoch %q", s)
+	}
+	return EpochTimeFloat(f, unit)
+}
+
+// EpochTime converts a Unix time in unit, or a detected one, to a time.Time.
+func EpochTime(n int64, unit string) (time.Time, error) {
+	if unit == "" {
+		unit = EpochUnit(float64(n))
+	}
+	switch unit {
+	case "s":
+		return time.Unix(n, 0).UTC(), nil
+	case "ms":
+		return time.UnixMilli(n).UTC(), nil
+	case "us":
+		return time.UnixMicro(n).UTC(), nil
+	case "ns":
+		return time.Unix(0, n).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown epoch unit %q", unit)
+	}
+}
+
+// EpochTimeFloat is EpochTime for fractional values.
+func EpochTimeFloat(f float64, unit string) (time.Time, error) {
+	if unit == "" {
+		unit = EpochUnit(f)
+	}
+	scale, ok := map[string]float64{"s": 1e9, "ms": 1e6, "us": 1e3, "ns": 1}[unit]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown epoch unit %q", unit)
+	}
+	nanos := f * scale
+	if math.IsNaN(nanos) || math.Abs(nanos) > math.MaxInt64 {
+		return time.Time{}, fmt.Errorf("epoch %v out of range", f)
+	}
+	return time.Unix(0, int64(nanos)).UTC(), nil
+}
+
+// EpochUnit guesses the unit of a Unix time from its magnitude.
+func EpochUnit(v float64) string {
+	switch v = math.Abs(v); {
+	case v < 1e11:
+		return "s"
+	case v < 1e14:
+		return "ms"
+	case v < 1e17:
+		return "us"
+	default:
+		return "ns"
+	}
 }
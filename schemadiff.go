@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"log-pipeline/config"
+	"log-pipeline/internal/schema"
+)
+
+// runSchemaDiff implements the "schema-diff" subcommand.
+func runSchemaDiff(args []string) {
+	fs := flag.NewFlagSet("schema-diff", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	name := fs.String("schema", "", "Schema to compare (defaults to the schema of the first pipeline)")
+	from := fs.Int("from", 0, "Old version (defaults to the version before -to)")
+	to := fs.Int("to", 0, "New version (defaults to the latest version)")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	schemas, err := loadSchemas(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+	if *name == "" {
+		*name = cfg.Pipelines[0].Victoria.Schema
+	}
+
+	newSchema, err := schemas.Get(*name, *to)
+	if err != nil {
+		log.Fatalf("Invalid -to: %v", err)
+	}
+	if *from == 0 {
+		for _, v := range schemas.Versions(*name) {
+			if v < newSchema.Version {
+				*from = v
+			}
+		}
+		if *from == 0 {
+			log.Fatalf("Schema %s has no version before %d", *name, newSchema.Version)
+		}
+	}
+	oldSchema, err := schemas.Get(*name, *from)
+	if err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+
+	// Stream fields appear in _stream filters as well as field filters
+	streamFields := make(map[string]bool)
+	for _, pc := range cfg.Pipelines {
+		if pc.Victoria.Schema == *name {
+			for _, f := range pc.Victoria.StreamFields {
+				streamFields[f] = true
+			}
+		}
+	}
+
+	fmt.Printf("%s: version %d -> %d\n", *name, oldSchema.Version, newSchema.Version)
+	breaking := false
+	for _, change := range schema.Diff(oldSchema, newSchema) {
+		line := change.String()
+		if streamFields[change.Field] {
+			line += " (stream field)"
+		}
+		fmt.Println(line)
+		breaking = breaking || change.Breaking
+	}
+	if breaking {
+		os.Exit(1)
+	}
+}
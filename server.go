@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"log-pipeline/internal/health"
+	"log-pipeline/internal/metrics"
+	"log-pipeline/internal/pipeline"
+	"log-pipeline/internal/push"
+)
+
+// statusServer serves the probes, the status document and the metrics.
+type statusServer struct {
+	healthChecker   *health.HealthChecker
+	pipelines       []*pipeline.Pipeline
+	started         time.Time
+	livenessTimeout time.Duration
+}
+
+func (s *statusServer) serve(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", s.handleLivez)
+	// /health predates the split probes and keeps liveness semantics
+	mux.HandleFunc("/health", s.handleLivez)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.Handle("/metrics", metrics.Default.Handler())
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Health check server error: %v", err)
+	}
+}
+
+// servePush serves the push receiver on addr.
+func servePush(addr string, handler *push.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(push.Path, handler)
+	// Agents probe the Loki readiness endpoint before pushing
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ready")
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("Receiving pushes on %s%s", addr, push.Path)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Push receiver error: %v", err)
+		}
+	}()
+	return server
+}
+
+// handleLivez fails only when a processing loop stopped completing windows.
+func (s *statusServer) handleLivez(w http.ResponseWriter, r *http.Request) {
+	var stalled []string
+	for _, p := range s.pipelines {
+		// A push-mode pipeline has no loop to stall
+		if p.Config().Loki.Mode == "push" {
+			continue
+		}
+		last := p.Status().LastAttempt
+		if last.IsZero() {
+			last = s.started
+		}
+
+		// A pipeline polling less often than the timeout is not stalled
+		timeout := s.livenessTimeout
+		if interval := 3 * time.Duration(p.Config().Loki.Interval); interval > timeout {
+			timeout = interval
+		}
+		if since := time.Since(last); since > timeout {
+			stalled = append(stalled, fmt.Sprintf("%s stalled for %v", p.Name(), since.Round(time.Second)))
+		}
+	}
+
+	if len(stalled) > 0 {
+		http.Error(w, strings.Join(stalled, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports the dependency state cached by the health checker.
+func (s *statusServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+	if !s.healthChecker.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, s.healthChecker.Statuses())
+}
+
+func (s *statusServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	pipelines := make(map[string]pipeline.Status, len(s.pipelines))
+	for _, p := range s.pipelines {
+		pipelines[p.Name()] = p.Status()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"started":      s.started,
+		"dependencies": s.healthChecker.Statuses(),
+		"pipelines":    pipelines,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}